@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"metrics/config"
+	"metrics/corpus"
+	"metrics/logger"
+	"metrics/metricstracker"
+	"metrics/models"
+	"metrics/parallel"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"metrics/signer"
+	"os"
+	"time"
+)
+
+// generateCorpus writes pre-built transfers for the configured accounts:
+// signed with the configured keys, or unsigned for the nodes' own
+// addresses. Nonces continue from the accounts' current nonces.
+func generateCorpus(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	n := fs.Int("n", 1000, "number of transfers")
+	out := fs.String("o", "", "corpus file to write (required)")
+	value := fs.Uint64("value", 1, "value of each transfer")
+	receiver := fs.String("receiver", "", "receiver address (default: the configured receiver)")
+	mock := fs.Bool("mock", false, "generate for a fresh mock node (see blast -mock) without querying a node")
+	mockAccounts := fs.Int("mock-accounts", 0, "with -mock, sign for this many generated accounts")
+	fs.Parse(args)
+	if *out == "" {
+		fmt.Fprintln(os.Stderr, "generate: -o is required")
+		return 2
+	}
+
+	logger.Init()
+	defer logger.Close()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		if !*mock {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			return 1
+		}
+		cfg = &config.AppConfig{}
+	}
+	if *receiver == "" {
+		*receiver = cfg.Receiver
+	}
+	if *receiver == "" && *mock {
+		*receiver = "0xmockreceiver"
+	}
+
+	var keys []*signer.Key
+	if len(cfg.Keys) > 0 {
+		if keys, err = signer.LoadKeys(cfg.Keys...); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load keys: %v\n", err)
+			return 1
+		}
+	}
+
+	var accounts []corpus.Account
+	if *mock {
+		for i := 0; i < *mockAccounts; i++ {
+			key, err := signer.GenerateKey()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			accounts = append(accounts, corpus.Account{Address: key.Address(), NextNonce: 1, Key: key})
+		}
+		if len(accounts) == 0 {
+			accounts = append(accounts, corpus.Account{Address: rpctest.DefaultNodeAddress, NextNonce: 1})
+		}
+	} else {
+		nodes := nodesFromConfig(cfg)
+		clientCfg, err := clientConfig(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+			return 1
+		}
+		client := rpc.NewClient(clientCfg)
+		defer client.CloseIdleConnections()
+
+		if len(keys) > 0 {
+			for _, key := range keys {
+				accounts = append(accounts, corpus.Account{Address: key.Address(), Key: key})
+			}
+		} else {
+			for _, addr := range accountAddresses(nodeAddresses(nodes), nil) {
+				accounts = append(accounts, corpus.Account{Address: addr})
+			}
+		}
+		adapter, err := corpusAdapter(cfg, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+			return 1
+		}
+		for i := range accounts {
+			next, err := adapter.GetNonce(context.Background(), nodes[0], accounts[i].Address)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read nonce of %s: %v\n", accounts[i].Address, err)
+				return 1
+			}
+			accounts[i].NextNonce = next
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create corpus: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	start := time.Now()
+	if err := corpus.Generate(corpus.NewWriter(f), accounts, *receiver, *value, *n); err != nil {
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+		return 1
+	}
+	if err := f.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+		return 1
+	}
+	fmt.Printf("wrote %d transfers from %d accounts to %s in %v\n", *n, len(accounts), *out, time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// blastCorpus submits a corpus and logs the same summary as a run.
+func blastCorpus(args []string) int {
+	fs := flag.NewFlagSet("blast", flag.ExitOnError)
+	rate := fs.Float64("rate", 0, "target submissions per second (default: as fast as possible)")
+	workers := fs.Int("workers", 16, "concurrent submissions")
+	mock := fs.Bool("mock", false, "blast an in-process mock node that funds the corpus senders")
+	grace := fs.Duration("grace", 30*time.Second, "after SIGINT or SIGTERM, how long to keep tracking before summarizing")
+	export := fs.String("export", "", "write the run summary to this file as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: blast [flags] FILE")
+		return 2
+	}
+	path := fs.Arg(0)
+
+	logger.Init()
+	defer logger.Close()
+
+	// First pass: find the senders, to subscribe to their events
+	signed, unsigned, err := corpusSenders(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "blast: %v\n", err)
+		return 1
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		if !*mock {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			return 1
+		}
+		cfg = &config.AppConfig{}
+	}
+
+	var nodes []model.NodeInfo
+	if *mock {
+		balances := make(map[string]uint64)
+		for _, addr := range signed {
+			balances[addr] = rpctest.DefaultBalance
+		}
+		mockCfg := rpctest.Config{
+			Balances:       balances,
+			ExecutionDelay: rpctest.Uniform{Min: 200 * time.Millisecond, Max: 800 * time.Millisecond},
+			FinalityDelay:  rpctest.Exponential{Mean: time.Second},
+		}
+		if len(unsigned) > 0 {
+			// The mock signs for a single account
+			mockCfg.NodeAddress = unsigned[0]
+		}
+		srv := rpctest.NewServer(mockCfg)
+		defer srv.Close()
+		nodes = append(nodes, srv.Node())
+	} else {
+		nodes = nodesFromConfig(cfg)
+	}
+
+	pool, err := newPool(cfg, nodes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return 1
+	}
+	clientCfg, err := clientConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return 1
+	}
+	retry, err := retryPolicyFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return 1
+	}
+	client := rpc.NewClient(clientCfg)
+	defer client.CloseIdleConnections()
+
+	adapter, err := corpusAdapter(cfg, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "blast: %v\n", err)
+		return 1
+	}
+
+	ctx, stopReason, stopSignals := interruptContext(context.Background())
+	defer stopSignals()
+	finishCtx, cancelFinish := withGrace(ctx, *grace)
+	defer cancelFinish()
+	pool.StartHealthChecks(ctx, adapter, cfg.Health.ProbeInterval)
+
+	tracker := metricstracker.NewTracker(adapter, pool.Nodes())
+	if len(signed) > 0 {
+		tracker.WatchSenders(append(signed, unsigned...))
+	}
+	if err := tracker.ListenForEvents(finishCtx); err != nil {
+		logger.Metrics.Printf("Event subscription unavailable, tracking by polling: %v", err)
+	}
+	defer tracker.Close()
+
+	r, err := corpus.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "blast: %v\n", err)
+		return 1
+	}
+	defer r.Close()
+
+	logger.Metrics.Printf("Blasting %s at %s with %d workers across %d nodes", path, rateLabel(*rate), *workers, len(nodes))
+
+	start := time.Now()
+	results, err := corpus.Blast(ctx, client, pool, r, corpus.BlastOptions{
+		Rate:    *rate,
+		Workers: *workers,
+		Retry:   retry,
+		OnResult: func(res corpus.Result) {
+			if res.Success {
+				tracker.MarkSubmitted(res.TxID, res.Node, res.SentAt)
+			}
+		},
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		logger.Metrics.Printf("Blast stopped early: %v", err)
+	}
+
+	stats := parallel.RunStats{Submitted: len(results)}
+	for _, res := range results {
+		stats.Retries += res.Retries
+		if res.Success {
+			stats.Successful++
+		} else {
+			stats.Failed++
+			logger.Metrics.Printf("Entry %d failed (sender=%s, nonce=%d, node=%s): %v", res.Seq, res.Sender, res.Nonce, res.Node, res.Error)
+		}
+	}
+	logger.Metrics.Printf("Blast completed: %d sent in %v (%.2f submissions/s), %d successful, %d failed",
+		len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds(), stats.Successful, stats.Failed)
+
+	executed, finalized := tracker.WaitAndCollect(finishCtx)
+	logger.Metrics.Printf("Execution phase completed: Executed=%d, Finalized=%d", executed, finalized)
+
+	var stopped error
+	if ctx.Err() != nil {
+		stopped = stopReason()
+	}
+	report := newReport(tracker, stats, stopped)
+	logSummary(report)
+	if *export != "" {
+		if err := exportReport(*export, report); err != nil {
+			fmt.Fprintf(os.Stderr, "blast: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// corpusAdapter returns the configured chain adapter, or an error if the
+// chain is not xygle: corpus entries hold xygle calls, which other chains
+// cannot take.
+func corpusAdapter(cfg *config.AppConfig, client *rpc.Client) (rpc.ChainAdapter, error) {
+	adapter, err := chainAdapter(cfg, client)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if adapter.Name() != "xygle" {
+		return nil, fmt.Errorf("corpus files hold xygle transfers and cannot be used on %s; unset chain.type or set it to xygle", adapter.Name())
+	}
+	return adapter, nil
+}
+
+// corpusSenders lists the distinct senders of signed and unsigned entries.
+func corpusSenders(path string) (signed, unsigned []string, err error) {
+	r, err := corpus.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	seen := make(map[string]bool)
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return signed, unsigned, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if seen[e.Sender] {
+			continue
+		}
+		seen[e.Sender] = true
+		if e.Signed {
+			signed = append(signed, e.Sender)
+		} else {
+			unsigned = append(unsigned, e.Sender)
+		}
+	}
+}
+
+func nodeAddresses(nodes []model.NodeInfo) []string {
+	addrs := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		addrs = append(addrs, n.Address)
+	}
+	return addrs
+}
+
+func rateLabel(rate float64) string {
+	if rate <= 0 {
+		return "full speed"
+	}
+	return fmt.Sprintf("%.2f tx/s", rate)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"metrics/config"
+	"metrics/logger"
+	"metrics/models"
+	"metrics/rpc"
+	"os"
+)
+
+// inspect runs one of the read-only query commands against a configured
+// node and prints the result as JSON. It returns the process exit code.
+func inspect(command string, args []string) int {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	nodeURL := fs.String("node", "", "URL of the node to query (default: the first configured node)")
+	var limit *int
+	var cursor *string
+	var all *bool
+	switch command {
+	case "txs":
+		limit = fs.Int("limit", 0, "transactions per page (default: the node's page size)")
+		cursor = fs.String("cursor", "", "continue from the next_cursor of a previous page")
+		all = fs.Bool("all", false, "follow next_cursor through every page")
+	case "activity":
+		limit = fs.Int("limit", 0, "number of entries (default: the node's default)")
+	}
+	fs.Parse(args)
+
+	logger.Init()
+	defer logger.Close()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		if *nodeURL == "" {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			return 1
+		}
+		cfg = &config.AppConfig{}
+	}
+	node, err := selectNode(nodesFromConfig(cfg), *nodeURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	address := node.Address
+	if fs.NArg() > 0 {
+		address = fs.Arg(0)
+	}
+	if address == "" && command != "stats" {
+		fmt.Fprintf(os.Stderr, "%s: no address given and the node has none configured\n", command)
+		return 2
+	}
+
+	clientCfg, err := clientConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return 1
+	}
+	client := rpc.NewClient(clientCfg)
+	defer client.CloseIdleConnections()
+	ctx := context.Background()
+
+	var result interface{}
+	switch command {
+	case "balance":
+		result, err = client.GetBalance(ctx, node, address)
+	case "txs":
+		if *all {
+			result, err = allTransactions(ctx, client, node, address, *cursor, *limit)
+		} else {
+			result, err = client.GetTransactions(ctx, node, address, *cursor, *limit)
+		}
+	case "activity":
+		result, err = client.GetAccountActivity(ctx, node, address, *limit)
+	case "stats":
+		result, err = client.GetNodeStats(ctx, node)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// selectNode returns the node with the given URL, or the first node if url
+// is empty. A URL that is not configured is queried as a bare node.
+func selectNode(nodes []model.NodeInfo, url string) (model.NodeInfo, error) {
+	if url == "" {
+		if len(nodes) == 0 || nodes[0].URL == "" {
+			return model.NodeInfo{}, fmt.Errorf("no node configured; pass -node")
+		}
+		return nodes[0], nil
+	}
+	for _, n := range nodes {
+		if n.URL == url {
+			return n, nil
+		}
+	}
+	return model.NodeInfo{URL: url}, nil
+}
+
+// allTransactions walks every page of the transaction list of address.
+func allTransactions(ctx context.Context, client *rpc.Client, node model.NodeInfo, address, cursor string, limit int) ([]model.TransactionResult, error) {
+	var txs []model.TransactionResult
+	for {
+		page, err := client.GetTransactions(ctx, node, address, cursor, limit)
+		if err != nil {
+			return txs, err
+		}
+		txs = append(txs, page.Transactions...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return txs, nil
+		}
+		cursor = page.NextCursor
+	}
+}
@@ -3,105 +3,236 @@ package main
 import (
 	"fmt"
 	"metrics/config"
-	"metrics/logger"
 	"metrics/models"
-	"metrics/parallel"
 	"metrics/rpc"
+	"metrics/schedule"
+	"metrics/workload"
+	"os"
+	"strings"
 )
 
-func main() {
-	logger.Init()
+const usage = `usage: metrics [command] [flags]
 
-	// Properly Load Configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		panic(fmt.Sprintf("failed to load config: %v", err))
-	}
+commands:
+  run                      submit transactions and log metrics (default)
+  balance [address]        show the balance of an account
+  txs [address]            list the transactions of an account, newest first
+  activity [address]       show the recent history of an account
+  stats                    show node statistics
+  generate -n N -o FILE    write N pre-built transfers to a corpus file
+  blast FILE               submit a corpus as fast as possible or at -rate
 
-	validatorNodes := model.NodeInfo{
-		NodeType: cfg.Node.Type,
-		URL:      cfg.Node.URL,
-		Address:  cfg.Node.Address,
-	}
-	receiver := cfg.Receiver
-	value := 1
-	numTx := 10
-	workers := 1
+Run "metrics <command> -h" for the flags of a command. The address defaults
+to the sender address of the queried node. generate and blast work with
+xygle nodes only and refuse any other configured chain.type.
+`
 
-	// Get transaction details
-	txDetail, _ := rpc.GetTransactionDetails(validatorNodes, "2b3210cc4c19d169765ddf3d4a01472356dc0263bf926ab2df8f309e27091e4a")
-	logger.Metrics.Printf("txDetail: %+v", txDetail)
+func main() {
+	args := os.Args[1:]
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	// Create parallel executor
-	executor, err := parallel.NewParallelExecutor(validatorNodes, workers)
-	if err != nil {
-		logger.Metrics.Printf("Failed to create parallel executor: %v", err)
-		return
+	switch command {
+	case "run":
+		os.Exit(runBenchmark(args))
+	case "balance", "txs", "activity", "stats":
+		os.Exit(inspect(command, args))
+	case "generate":
+		os.Exit(generateCorpus(args))
+	case "blast":
+		os.Exit(blastCorpus(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
+}
 
-	// Prepare transaction requests
-	var requests []parallel.TransactionRequest
-	for i := 1; i <= numTx; i++ {
-		requests = append(requests, parallel.TransactionRequest{
-			ID:       i,
-			Receiver: receiver,
-			Value:    value,
+func nodesFromConfig(cfg *config.AppConfig) []model.NodeInfo {
+	var nodes []model.NodeInfo
+	for _, n := range cfg.NodeList() {
+		nodes = append(nodes, model.NodeInfo{
+			NodeType: n.Type,
+			URL:      n.URL,
+			Address:  n.Address,
+			WSURL:    n.WSURL,
+			Weight:   n.Weight,
 		})
 	}
+	return nodes
+}
 
-	logger.Metrics.Printf("Starting sequential execution of %d transactions with %d workers", numTx, workers)
-
-	// Execute transactions with proper nonce coordination
-	results, err := executor.ExecuteTransactions(requests)
+func clientConfig(cfg *config.AppConfig) (rpc.ClientConfig, error) {
+	endpoints, err := endpointsFromConfig(cfg)
 	if err != nil {
-		logger.Metrics.Printf("Failed to execute transactions: %v", err)
-		return
+		return rpc.ClientConfig{}, err
 	}
+	return rpc.ClientConfig{
+		MaxIdleConns:          cfg.RPC.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.RPC.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.RPC.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.RPC.IdleConnTimeout,
+		DialTimeout:           cfg.RPC.DialTimeout,
+		KeepAlive:             cfg.RPC.KeepAlive,
+		TLSHandshakeTimeout:   cfg.RPC.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.RPC.ResponseHeaderTimeout,
+		RequestTimeout:        cfg.RPC.RequestTimeout,
+		BatchSize:             cfg.RPC.BatchSize,
+		Endpoints:             endpoints,
+	}, nil
+}
+
+// endpointsFromConfig resolves the credentials and TLS settings of every
+// node that has any, keyed by both its HTTP and WebSocket URL.
+func endpointsFromConfig(cfg *config.AppConfig) (map[string]rpc.Endpoint, error) {
+	endpoints := make(map[string]rpc.Endpoint)
+	for _, n := range cfg.NodeList() {
+		header, err := n.Header()
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", n.URL, err)
+		}
+		tlsConfig, err := rpc.TLSFiles{
+			CAFile:             n.TLS.CAFile,
+			CertFile:           n.TLS.CertFile,
+			KeyFile:            n.TLS.KeyFile,
+			ServerName:         n.TLS.ServerName,
+			InsecureSkipVerify: n.TLS.InsecureSkipVerify,
+		}.Load()
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", n.URL, err)
+		}
+		if len(header) == 0 && tlsConfig == nil {
+			continue
+		}
 
-	// Log submission results
-	successful := 0
-	failed := 0
-	for _, result := range results {
-		if result.Success {
-			successful++
-			logger.Metrics.Printf("Transaction %d submitted successfully (nonce=%d, txID=%s, latency=%.3fs)",
-				result.ID, result.Nonce, result.TxID, result.Latency.Seconds())
-		} else {
-			failed++
-			logger.Metrics.Printf("Transaction %d failed (nonce=%d): %v", result.ID, result.Nonce, result.Error)
+		ep := rpc.Endpoint{Header: header, TLS: tlsConfig}
+		endpoints[n.URL] = ep
+		if n.WSURL != "" {
+			endpoints[n.WSURL] = ep
 		}
 	}
+	return endpoints, nil
+}
 
-	logger.Metrics.Printf("Submission phase completed: %d successful, %d failed", successful, failed)
+func chainAdapter(cfg *config.AppConfig, client *rpc.Client) (rpc.ChainAdapter, error) {
+	return rpc.NewChainAdapter(client, rpc.ChainConfig{
+		Type:          cfg.Chain.Type,
+		Confirmations: cfg.Chain.Confirmations,
+	})
+}
 
-	// Wait for execution and finalization
-	executed, finalized := executor.WaitForCompletion()
-	logger.Metrics.Printf("Execution phase completed: Executed=%d, Finalized=%d", executed, finalized)
+// profileFromConfig builds the load profile configured in cfg, or returns
+// nil if there is none.
+func profileFromConfig(cfg *config.AppConfig) (schedule.Profile, error) {
+	var profile schedule.Profile
+	for i, pc := range cfg.Profile {
+		kind := strings.ToLower(pc.Type)
+		if kind == "" {
+			kind = "constant"
+		}
+		phase := schedule.Phase{Name: pc.Name, Duration: pc.Duration, Rate: pc.Rate, Workers: pc.Workers}
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("%d-%s", i+1, kind)
+		}
+		switch kind {
+		case "ramp", "step":
+			if pc.Workers > 0 {
+				return nil, fmt.Errorf("phase %s: %s phases take a rate, not workers", phase.Name, kind)
+			}
+			if pc.To <= 0 {
+				return nil, fmt.Errorf("phase %s: %s phases need a positive to", phase.Name, kind)
+			}
+			phase.EndRate = pc.To
+			if kind == "step" {
+				if pc.Steps < 2 {
+					return nil, fmt.Errorf("phase %s: step phases need at least 2 steps", phase.Name)
+				}
+				phase.Steps = pc.Steps
+			}
+		case "spike", "soak", "constant":
+		default:
+			return nil, fmt.Errorf("phase %s: unknown type %q (want ramp, step, spike, soak or constant)", phase.Name, pc.Type)
+		}
+		if err := phase.Validate(); err != nil {
+			return nil, err
+		}
+		profile = append(profile, phase)
+	}
+	return profile, nil
+}
 
-	// Generate summary
-	tracker := executor.GetTracker()
-	sum, err := tracker.Summarize()
+// workloadFromConfig builds the workload configured in cfg, along with the
+// receivers it sends to. Receivers default to the top-level receiver and a
+// zero seed to seed.
+func workloadFromConfig(cfg *config.AppConfig, seed int64) (workload.Workload, []string, error) {
+	wc := cfg.Workload
+	receivers := wc.Receivers
+	if len(receivers) == 0 && cfg.Receiver != "" {
+		receivers = []string{cfg.Receiver}
+	}
+	if wc.Seed != 0 {
+		seed = wc.Seed
+	}
+	load, err := workload.New(wc.Name, workload.Spec{
+		Receivers:    receivers,
+		Distribution: wc.Distribution,
+		ZipfS:        wc.ZipfS,
+		Value: workload.ValueSpec{
+			Distribution: wc.Value.Distribution,
+			Value:        wc.Value.Value,
+			Min:          wc.Value.Min,
+			Max:          wc.Value.Max,
+			Mean:         wc.Value.Mean,
+			StdDev:       wc.Value.StdDev,
+		},
+		Seed:   seed,
+		Params: wc.Params,
+	})
 	if err != nil {
-		logger.Metrics.Printf("Summary note: %v", err)
+		return nil, nil, err
 	}
+	return load, receivers, nil
+}
 
-	// Per-transaction metrics
-	for txID, lat := range sum.LatencySeconds {
-		logger.Metrics.Printf("Tx %s latency=%.2fs", txID, lat)
+// retryPolicyFromConfig builds the retry policy configured in cfg.
+func retryPolicyFromConfig(cfg *config.AppConfig) (rpc.RetryPolicy, error) {
+	policy := retryPolicy(cfg.Retry)
+	for class, rc := range cfg.Retry.Overrides {
+		if policy.Overrides == nil {
+			policy.Overrides = make(map[string]rpc.RetryPolicy)
+		}
+		policy.Overrides[class] = retryPolicy(rc)
+	}
+	if err := policy.Validate(); err != nil {
+		return rpc.RetryPolicy{}, err
 	}
-	for txID, fin := range sum.TimeToFinalSeconds {
-		logger.Metrics.Printf("Tx %s time_to_final=%.2fs", txID, fin)
+	return policy, nil
+}
+
+func retryPolicy(rc config.RetryConfig) rpc.RetryPolicy {
+	return rpc.RetryPolicy{
+		Strategy:    rpc.RetryStrategy(rc.Strategy),
+		MaxAttempts: rc.MaxAttempts,
+		BaseDelay:   rc.BaseDelay,
+		MaxDelay:    rc.MaxDelay,
+		Multiplier:  rc.Multiplier,
+		MaxElapsed:  rc.MaxElapsed,
 	}
+}
 
-	// Summary metrics
-	logger.Metrics.Printf("PERFORMANCE SUMMARY")
-	logger.Metrics.Printf("Total submitted: %d, Successful: %d, Failed: %d", len(results), successful, failed)
-	logger.Metrics.Printf("Executed: %d, Finalized: %d", sum.ExecutedCount, sum.FinalizedCount)
-	logger.Metrics.Printf("Average latency: %.2fs over %d executed txs", sum.AvgLatencySeconds, sum.ExecutedCount)
-	if sum.FinalizedCount > 0 {
-		logger.Metrics.Printf("Average time-to-finality: %.2fs over %d finalized txs", sum.AvgTimeToFinalSeconds, sum.FinalizedCount)
-	} else {
-		logger.Metrics.Printf("No txs reached finality within the timeout window")
+func newPool(cfg *config.AppConfig, nodes []model.NodeInfo) (*rpc.NodePool, error) {
+	strategy, err := rpc.ParseStrategy(cfg.LoadBalancing)
+	if err != nil {
+		return nil, err
 	}
-	logger.Metrics.Printf("Estimated TPS: %.2f", sum.TPS)
+	return rpc.NewNodePool(nodes, strategy, rpc.BreakerConfig{
+		Window:           cfg.Health.Window,
+		MinRequests:      cfg.Health.MinRequests,
+		FailureRate:      cfg.Health.FailureRate,
+		OpenTimeout:      cfg.Health.OpenTimeout,
+		HalfOpenRequests: cfg.Health.HalfOpenRequests,
+	})
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"metrics/metricstracker"
+	"metrics/parallel"
+	"os"
+	"time"
+)
+
+// runReport is the outcome of a run as logged and exported: submission
+// totals and the tracker summary.
+type runReport struct {
+	// Partial is set when the run was stopped before it finished, and
+	// StopReason says why.
+	Partial     bool                   `json:"partial"`
+	StopReason  string                 `json:"stop_reason,omitempty"`
+	FinishedAt  time.Time              `json:"finished_at"`
+	Submitted   int                    `json:"submitted"`
+	Successful  int                    `json:"successful"`
+	Failed      int                    `json:"failed"`
+	Retries     int                    `json:"retries"`
+	SummaryNote string                 `json:"summary_note,omitempty"`
+	Summary     metricstracker.Summary `json:"summary"`
+	// Ambiguous counts submissions whose outcome was unknown after an
+	// attempt timed out or lost its connection; Landed those of them
+	// found on a node and counted as successful.
+	Ambiguous int `json:"ambiguous"`
+	Landed    int `json:"landed"`
+}
+
+// newReport summarizes tracker after submissions totalling stats. stopped,
+// if not nil, is why the run ended early.
+func newReport(tracker *metricstracker.Tracker, stats parallel.RunStats, stopped error) runReport {
+	r := runReport{
+		FinishedAt: time.Now(),
+		Submitted:  stats.Submitted,
+		Successful: stats.Successful,
+		Failed:     stats.Failed,
+		Retries:    stats.Retries,
+		Ambiguous:  stats.Ambiguous,
+		Landed:     stats.Landed,
+	}
+	var err error
+	if r.Summary, err = tracker.Summarize(); err != nil {
+		r.SummaryNote = err.Error()
+	}
+	if stopped != nil {
+		r.Partial = true
+		r.StopReason = stopped.Error()
+	}
+	return r
+}
+
+// exportReport writes r to path as JSON.
+func exportReport(path string, r runReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
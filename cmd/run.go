@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"metrics/config"
+	"metrics/logger"
+	"metrics/models"
+	"metrics/nonce"
+	"metrics/parallel"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"metrics/schedule"
+	"metrics/signer"
+	"os"
+	"time"
+)
+
+// runBenchmark submits transactions through the configured nodes and logs
+// the performance summary to metrics.log. It returns the exit code.
+func runBenchmark(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	mock := fs.Bool("mock", false, "run against an in-process mock node instead of the configured nodes")
+	record := fs.String("record", "", "record all RPC traffic to this cassette file")
+	replay := fs.String("replay", "", "answer RPC calls from this cassette file instead of the nodes")
+	replaySpeed := fs.Float64("replay-speed", 1, "replay timing multiplier; 0 replays instantly")
+	mockAccounts := fs.Int("mock-accounts", 0, "with -mock, sign locally for this many generated, funded accounts")
+	numTx := fs.Int("n", 10, "number of transactions to submit; ignored when the config has a profile")
+	duration := fs.Duration("duration", 0, "submit for this long instead of -n transactions, e.g. 30m")
+	drain := fs.Duration("drain", 5*time.Minute, "how long to keep tracking after submission stops")
+	grace := fs.Duration("grace", 30*time.Second, "after SIGINT or SIGTERM, how long to keep tracking before summarizing")
+	export := fs.String("export", "", "write the run summary to this file as JSON")
+	journalPath := fs.String("journal", "", "record nonce use in this file and resume from it after a crash")
+	workers := fs.Int("workers", 1, "concurrent submissions in closed-loop runs")
+	rate := fs.Float64("rate", 0, "open-loop target TPS; 0 runs closed-loop with -workers")
+	arrivals := fs.String("arrivals", "constant", "open-loop arrivals, also within profile phases: constant, token_bucket or poisson")
+	burst := fs.Int("burst", 1, "with -arrivals token_bucket, transactions let through at once")
+	seed := fs.Int64("seed", 0, "seed for poisson arrival times and the workload (0 picks one)")
+	fs.Parse(args)
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	if _, err := schedule.Parse(*arrivals, 1, *burst, *seed); err != nil {
+		fmt.Fprintf(os.Stderr, "run: %v\n", err)
+		return 2
+	}
+	var sched schedule.Scheduler
+	if *rate > 0 {
+		var err error
+		if sched, err = schedule.Parse(*arrivals, *rate, *burst, *seed); err != nil {
+			fmt.Fprintf(os.Stderr, "run: %v\n", err)
+			return 2
+		}
+	}
+
+	logger.Init()
+	defer logger.Close()
+
+	// Properly Load Configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		if !*mock {
+			panic(fmt.Sprintf("failed to load config: %v", err))
+		}
+		cfg = &config.AppConfig{}
+	}
+	profile, err := profileFromConfig(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config: %v", err))
+	}
+
+	// Sign locally when account keys are configured
+	var keys []*signer.Key
+	if len(cfg.Keys) > 0 {
+		if keys, err = signer.LoadKeys(cfg.Keys...); err != nil {
+			panic(fmt.Sprintf("failed to load keys: %v", err))
+		}
+	}
+
+	var validatorNodes []model.NodeInfo
+	if *mock {
+		balances := make(map[string]uint64)
+		for i := 0; i < *mockAccounts; i++ {
+			key, err := signer.GenerateKey()
+			if err != nil {
+				panic(err)
+			}
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			balances[key.Address()] = rpctest.DefaultBalance
+		}
+
+		// Offline run: one mock node with testnet-like confirmation times
+		srv := rpctest.NewServer(rpctest.Config{
+			Balances:       balances,
+			ExecutionDelay: rpctest.Uniform{Min: 200 * time.Millisecond, Max: 800 * time.Millisecond},
+			FinalityDelay:  rpctest.Exponential{Mean: time.Second},
+		})
+		defer srv.Close()
+		validatorNodes = append(validatorNodes, srv.Node())
+		if cfg.Receiver == "" {
+			cfg.Receiver = "0xmockreceiver"
+		}
+	} else {
+		validatorNodes = nodesFromConfig(cfg)
+	}
+	if *replay != "" {
+		// Subscriptions are not recorded; track by polling the cassette
+		for i := range validatorNodes {
+			validatorNodes[i].WSURL = ""
+		}
+	}
+	pool, err := newPool(cfg, validatorNodes)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config: %v", err))
+	}
+	load, receivers, err := workloadFromConfig(cfg, *seed)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config: %v", err))
+	}
+	retry, err := retryPolicyFromConfig(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config: %v", err))
+	}
+
+	// A signal stops submission; tracking and the summary run on finishCtx,
+	// which outlives ctx by the grace period
+	ctx, stopReason, stopSignals := interruptContext(context.Background())
+	defer stopSignals()
+	finishCtx, cancelFinish := withGrace(ctx, *grace)
+	defer cancelFinish()
+
+	clientCfg, err := clientConfig(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config: %v", err))
+	}
+	switch {
+	case *replay != "":
+		entries, err := rpc.LoadCassette(*replay)
+		if err != nil {
+			panic(fmt.Sprintf("failed to load cassette: %v", err))
+		}
+		clientCfg.Transport = rpc.NewReplayer(entries, *replaySpeed)
+		logger.Metrics.Printf("Replaying %d recorded round trips from %s (speed %.2f)", len(entries), *replay, *replaySpeed)
+	case *record != "":
+		recorder, err := rpc.NewRecorder(*record, rpc.NewTransport(clientCfg))
+		if err != nil {
+			panic(fmt.Sprintf("failed to start recording: %v", err))
+		}
+		defer recorder.Close()
+		clientCfg.Transport = recorder
+	}
+
+	// One client shared by every component of the run
+	client := rpc.NewClient(clientCfg)
+	defer client.CloseIdleConnections()
+
+	adapter, err := runAdapter(cfg, client, len(keys) > 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "run: %v\n", err)
+		return 2
+	}
+
+	// Probe node liveness in the background; failing nodes drop out of the pool
+	pool.StartHealthChecks(ctx, adapter, cfg.Health.ProbeInterval)
+
+	// Create parallel executor
+	executor, err := parallel.NewParallelExecutor(ctx, adapter, pool, *workers)
+	if err != nil {
+		logger.Metrics.Printf("Failed to create parallel executor: %v", err)
+		return 1
+	}
+	if err := executor.SetRetryPolicy(retry); err != nil {
+		logger.Metrics.Printf("Failed to set retry policy: %v", err)
+		return 1
+	}
+	logger.Metrics.Printf("Retry policy: %v", retry)
+	if *journalPath != "" {
+		journal, err := nonce.OpenJournal(*journalPath)
+		if err != nil {
+			logger.Metrics.Printf("Failed to open nonce journal: %v", err)
+			return 1
+		}
+		defer journal.Close()
+		if err := executor.UseJournal(ctx, journal); err != nil {
+			logger.Metrics.Printf("Failed to recover nonces: %v", err)
+			return 1
+		}
+	}
+	senders := nodeAddresses(validatorNodes)
+	if len(keys) > 0 {
+		if err := executor.UseSigners(ctx, keys); err != nil {
+			logger.Metrics.Printf("Failed to set up local signing: %v", err)
+			return 1
+		}
+		senders = senders[:0]
+		for _, key := range keys {
+			senders = append(senders, key.Address())
+		}
+		logger.Metrics.Printf("Signing locally for %d accounts", len(keys))
+	}
+
+	// Prefer execution/finality events over polling when the node has a WebSocket endpoint
+	tracker := executor.GetTracker()
+	if err := tracker.ListenForEvents(finishCtx); err != nil {
+		logger.Metrics.Printf("Event subscription unavailable, tracking by polling: %v", err)
+	}
+	defer tracker.Close()
+
+	// Snapshot balances so the run can be checked against the ledger
+	accounts := accountAddresses(senders, receivers)
+	balancesBefore := accountBalances(ctx, adapter, validatorNodes[0], accounts)
+
+	// Fixed-size runs take their requests from the workload up front
+	var requests []parallel.TransactionRequest
+	if len(profile) == 0 && *duration == 0 {
+		for len(requests) < *numTx {
+			req, ok := load.Next()
+			if !ok {
+				break
+			}
+			requests = append(requests, req)
+		}
+	}
+	tracker.SetTimeout(*drain)
+
+	// Log and count each submission as it completes
+	var stats parallel.RunStats
+	phaseStats := make(map[string]*parallel.RunStats)
+	handle := func(result parallel.TransactionResult) {
+		stats.Add(result)
+		if result.Phase != "" {
+			if phaseStats[result.Phase] == nil {
+				phaseStats[result.Phase] = &parallel.RunStats{}
+			}
+			phaseStats[result.Phase].Add(result)
+		}
+		if result.Success {
+			logger.Metrics.Printf("Transaction %d submitted successfully (nonce=%d, txID=%s, node=%s, latency=%.3fs)",
+				result.ID, result.Nonce, result.TxID, result.Node, result.Latency.Seconds())
+		} else {
+			logger.Metrics.Printf("Transaction %d failed (nonce=%d, node=%s): %v", result.ID, result.Nonce, result.Node, result.Error)
+		}
+	}
+
+	// Execute transactions with proper nonce coordination
+	switch {
+	case len(profile) > 0:
+		// Each open-loop phase draws its arrivals afresh, at rate 1
+		phaseSeed := *seed
+		unitArrivals := func() schedule.Scheduler {
+			s, _ := schedule.Parse(*arrivals, 1, *burst, phaseSeed)
+			phaseSeed++
+			return s
+		}
+		logger.Metrics.Printf("Starting load profile of %d phases over %v (%s arrivals) across %d nodes (%s)",
+			len(profile), profile.Duration(), *arrivals, len(validatorNodes), pool.Strategy())
+		for _, phase := range profile {
+			logger.Metrics.Printf("Phase %s: %s", phase.Name, describePhase(phase))
+		}
+		err = executor.StreamProfile(ctx, profile, unitArrivals, load, handle)
+	case *duration > 0:
+		// Requests are generated as needed, so memory stays flat however
+		// long the run lasts
+		if sched != nil {
+			logger.Metrics.Printf("Starting open-loop execution for %v at %.2f TPS (%s arrivals) across %d nodes (%s)",
+				*duration, *rate, *arrivals, len(validatorNodes), pool.Strategy())
+		} else {
+			logger.Metrics.Printf("Starting sequential execution for %v with %d workers across %d nodes (%s)",
+				*duration, *workers, len(validatorNodes), pool.Strategy())
+		}
+		err = executor.StreamFor(ctx, load, *duration, sched, handle)
+	case sched != nil:
+		logger.Metrics.Printf("Starting open-loop execution of %d transactions at %.2f TPS (%s arrivals) across %d nodes (%s)",
+			*numTx, *rate, *arrivals, len(validatorNodes), pool.Strategy())
+		err = executor.StreamOpenLoop(ctx, requests, sched, handle)
+	default:
+		logger.Metrics.Printf("Starting sequential execution of %d transactions with %d workers across %d nodes (%s)",
+			*numTx, *workers, len(validatorNodes), pool.Strategy())
+		err = executor.StreamTransactions(ctx, requests, handle)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Metrics.Printf("Failed to execute transactions: %v", err)
+			return 1
+		}
+		logger.Metrics.Printf("Submission stopped early: %v", stopReason())
+	}
+
+	logger.Metrics.Printf("Submission phase completed: %d successful, %d failed", stats.Successful, stats.Failed)
+	if len(profile) > 0 {
+		logPhaseSubmissions(profile, phaseStats)
+	}
+	if stats.Scheduled > 0 {
+		logger.Metrics.Printf("Schedule lag: average %v, worst %v over %d txs",
+			stats.ScheduleLag/time.Duration(stats.Scheduled), stats.MaxScheduleLag, stats.Scheduled)
+	}
+	if len(keys) > 0 && stats.Submitted > 0 {
+		logger.Metrics.Printf("Average signing time: %v over %d txs", stats.SignLatency/time.Duration(stats.Submitted), stats.Submitted)
+	}
+	breakers := pool.BreakerStates()
+	for _, node := range validatorNodes {
+		logger.Metrics.Printf("Node %s accepted %d transactions (circuit %s)", node.URL, stats.PerNode[node.URL], breakers[node.URL])
+	}
+
+	// Wait for execution and finalization
+	executed, finalized := executor.WaitForCompletion(finishCtx)
+	logger.Metrics.Printf("Execution phase completed: Executed=%d, Finalized=%d", executed, finalized)
+	if gaps := executor.NonceGapStats(); gaps != (nonce.GapStats{}) {
+		logger.Metrics.Printf("Nonce gaps: detected=%d filled=%d, released nonces reused=%d, resyncs=%d",
+			gaps.Detected, gaps.Filled, gaps.Reused, gaps.Resynced)
+	}
+
+	if finishCtx.Err() != nil {
+		logger.Metrics.Printf("Grace period over, skipping the balance check")
+	} else {
+		balancesAfter := accountBalances(finishCtx, adapter, validatorNodes[0], accounts)
+		for _, addr := range accounts {
+			before, after := balancesBefore[addr], balancesAfter[addr]
+			if before == nil || after == nil {
+				logger.Metrics.Printf("Balance of %s: unavailable", addr)
+				continue
+			}
+			logger.Metrics.Printf("Balance of %s: before=%s after=%s change=%s",
+				addr, before, after, new(big.Int).Sub(after, before))
+		}
+		logger.Metrics.Printf("Accepted transfer total: %d over %d accepted, %d executed",
+			stats.AcceptedValue, stats.Successful, executed)
+	}
+
+	var stopped error
+	if ctx.Err() != nil {
+		stopped = stopReason()
+	}
+	report := newReport(tracker, stats, stopped)
+	logSummary(report)
+	if *export != "" {
+		if err := exportReport(*export, report); err != nil {
+			logger.Error.Printf("%v", err)
+		}
+	}
+	return 0
+}
+
+// logSummary logs the per-transaction metrics and the performance summary
+// of r.
+func logSummary(r runReport) {
+	sum := r.Summary
+	if r.SummaryNote != "" {
+		logger.Metrics.Printf("Summary note: %s", r.SummaryNote)
+	}
+
+	// Per-transaction metrics
+	for txID, lat := range sum.LatencySeconds {
+		logger.Metrics.Printf("Tx %s latency=%.2fs (detected by %s)", txID, lat, sum.LatencyDetection[txID])
+	}
+	for txID, fin := range sum.TimeToFinalSeconds {
+		logger.Metrics.Printf("Tx %s time_to_final=%.2fs (detected by %s)", txID, fin, sum.FinalDetection[txID])
+	}
+
+	// Summary metrics
+	if r.Partial {
+		logger.Metrics.Printf("PERFORMANCE SUMMARY (partial run: %s)", r.StopReason)
+	} else {
+		logger.Metrics.Printf("PERFORMANCE SUMMARY")
+	}
+	logger.Metrics.Printf("Total submitted: %d, Successful: %d, Failed: %d", r.Submitted, r.Successful, r.Failed)
+	logger.Metrics.Printf("Retry attempts: %d", r.Retries)
+	if r.Ambiguous > 0 {
+		logger.Metrics.Printf("Ambiguous outcomes: %d, of which %d found landed on a node", r.Ambiguous, r.Landed)
+	}
+	logger.Metrics.Printf("Executed: %d, Finalized: %d, Failed: %d", sum.ExecutedCount, sum.FinalizedCount, sum.FailedCount)
+	logger.Metrics.Printf("Average latency: %.2fs over %d executed txs", sum.AvgLatencySeconds, sum.ExecutedCount)
+	if sum.ScheduledCount > 0 {
+		logger.Metrics.Printf("Average corrected latency: %.2fs (from intended start)", sum.AvgCorrectedLatencySeconds)
+	}
+	if sum.FinalizedCount > 0 {
+		logger.Metrics.Printf("Average time-to-finality: %.2fs over %d finalized txs", sum.AvgTimeToFinalSeconds, sum.FinalizedCount)
+	} else {
+		logger.Metrics.Printf("No txs reached finality within the timeout window")
+	}
+	logger.Metrics.Printf("Estimated TPS: %.2f", sum.TPS)
+
+	for _, ps := range sum.Phases {
+		logger.Metrics.Printf("Phase %s: executed=%d/%d finalized=%d failed=%d latency=%.2fs corrected=%.2fs p95=%.2fs time_to_final=%.2fs tps=%.2f",
+			ps.Name, ps.ExecutedCount, ps.TrackedCount, ps.FinalizedCount, ps.FailedCount, ps.AvgLatencySeconds,
+			ps.AvgCorrectedLatencySeconds, ps.P95CorrectedLatencySeconds, ps.AvgTimeToFinalSeconds, ps.TPS)
+	}
+}
+
+// describePhase summarises the load a profile phase applies.
+func describePhase(phase schedule.Phase) string {
+	switch {
+	case phase.Workers > 0:
+		return fmt.Sprintf("%d workers for %v", phase.Workers, phase.Duration)
+	case phase.EndRate > 0 && phase.Steps > 0:
+		return fmt.Sprintf("%.2f to %.2f TPS in %d steps over %v", phase.Rate, phase.EndRate, phase.Steps, phase.Duration)
+	case phase.EndRate > 0:
+		return fmt.Sprintf("%.2f to %.2f TPS over %v", phase.Rate, phase.EndRate, phase.Duration)
+	}
+	return fmt.Sprintf("%.2f TPS for %v", phase.Rate, phase.Duration)
+}
+
+// logPhaseSubmissions logs how many transactions each profile phase sent
+// and how many of them were accepted.
+func logPhaseSubmissions(profile schedule.Profile, phaseStats map[string]*parallel.RunStats) {
+	for _, phase := range profile {
+		var stats parallel.RunStats
+		if phaseStats[phase.Name] != nil {
+			stats = *phaseStats[phase.Name]
+		}
+		logger.Metrics.Printf("Phase %s submitted %d transactions (%.2f TPS), %d accepted",
+			phase.Name, stats.Submitted, float64(stats.Submitted)/phase.Duration.Seconds(), stats.Successful)
+	}
+}
+
+// accountAddresses lists every sender and then every receiver, once each.
+func accountAddresses(senders, receivers []string) []string {
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, addr := range append(append([]string{}, senders...), receivers...) {
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// accountBalances reads the balance of every address from node. Accounts
+// that cannot be read are left out.
+func accountBalances(ctx context.Context, adapter rpc.ChainAdapter, node model.NodeInfo, addrs []string) map[string]*big.Int {
+	balances := make(map[string]*big.Int)
+	for _, addr := range addrs {
+		balance, err := adapter.GetBalance(ctx, node, addr)
+		if err != nil {
+			logger.Error.Printf("failed to read balance of %s: %v", addr, err)
+			continue
+		}
+		balances[addr] = balance
+	}
+	return balances
+}
+
+// runAdapter returns the configured chain adapter, or an error if signing
+// locally on a chain other than xygle: signed transactions are xygle
+// transfers, which other chains cannot take.
+func runAdapter(cfg *config.AppConfig, client *rpc.Client, signing bool) (rpc.ChainAdapter, error) {
+	adapter, err := chainAdapter(cfg, client)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if signing && adapter.Name() != "xygle" {
+		return nil, fmt.Errorf("local signing produces xygle transfers and is not supported on %s; remove keys or set chain.type to xygle", adapter.Name())
+	}
+	return adapter, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"metrics/logger"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// interruptContext returns a context that the first SIGINT or SIGTERM
+// cancels, so a run stops submitting and winds down. A second signal exits
+// at once. The context is cancelled without a cause, so requests it
+// interrupts still match context.Canceled and are not taken for node
+// failures; reason reports why it was cancelled instead. stop releases the
+// signals.
+func interruptContext(parent context.Context) (ctx context.Context, reason func() error, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	var mu sync.Mutex
+	var stopped error
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Metrics.Printf("Received %v, stopping the run", sig)
+			fmt.Fprintf(os.Stderr, "received %v, stopping the run; repeat to exit immediately\n", sig)
+			mu.Lock()
+			stopped = fmt.Errorf("stopped by signal: %v", sig)
+			mu.Unlock()
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-sigs:
+			logger.Metrics.Printf("Received %v again, exiting without a summary", sig)
+			logger.Sync()
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	reason = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped != nil {
+			return stopped
+		}
+		return ctx.Err()
+	}
+	return ctx, reason, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// withGrace returns a context that outlives ctx: it is only cancelled grace
+// after ctx is done, or by cancel. Work that must finish after an interrupt,
+// such as tracking and the final summary, runs on it.
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-graceCtx.Done():
+			return
+		}
+		logger.Metrics.Printf("Tracking for up to %v before summarizing", grace)
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-graceCtx.Done():
+		}
+	}()
+	return graceCtx, cancel
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AuthConfig authenticates requests to a node. Token and Password are
+// secret references, "env:NAME" or "file:PATH", so secrets stay out of the
+// config file.
+type AuthConfig struct {
+	// Type is bearer or basic; empty disables authentication.
+	Type     string `mapstructure:"type"`
+	Token    string `mapstructure:"token"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// TLSConfig points at a node's TLS material. CAFile replaces the system
+// roots; CertFile and KeyFile enable mutual TLS.
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// ResolveSecret returns the value ref points to: "env:NAME" reads an
+// environment variable and "file:PATH" reads a file, both without
+// surrounding whitespace. Any other string is returned as is.
+func ResolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return strings.TrimSpace(value), nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return ref, nil
+}
+
+// secret resolves ref, refusing values written into the config directly.
+func secret(field, ref string) (string, error) {
+	if !strings.HasPrefix(ref, "env:") && !strings.HasPrefix(ref, "file:") {
+		return "", fmt.Errorf("%s must be given as env:NAME or file:PATH", field)
+	}
+	value, err := ResolveSecret(ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", field, err)
+	}
+	return value, nil
+}
+
+// Header returns the headers to send with every request to the node: its
+// Headers, whose values may also be secret references, and the
+// Authorization header for Auth.
+func (n NodeConfig) Header() (http.Header, error) {
+	header := make(http.Header)
+	for name, ref := range n.Headers {
+		value, err := ResolveSecret(ref)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+		header.Set(name, value)
+	}
+
+	switch strings.ToLower(n.Auth.Type) {
+	case "":
+	case "bearer":
+		token, err := secret("auth.token", n.Auth.Token)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	case "basic":
+		username, err := ResolveSecret(n.Auth.Username)
+		if err != nil {
+			return nil, fmt.Errorf("auth.username: %v", err)
+		}
+		password, err := secret("auth.password", n.Auth.Password)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	default:
+		return nil, fmt.Errorf("unknown auth type %q (want bearer or basic)", n.Auth.Type)
+	}
+	return header, nil
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -9,11 +12,132 @@ type NodeConfig struct {
 	Type    string `mapstructure:"type"`
 	URL     string `mapstructure:"url"`
 	Address string `mapstructure:"address"`
+	WSURL   string `mapstructure:"ws_url"`
+	Weight  int    `mapstructure:"weight"`
+	// Auth, Headers and TLS apply to every request to the node, including
+	// its WebSocket handshake.
+	Auth    AuthConfig        `mapstructure:"auth"`
+	Headers map[string]string `mapstructure:"headers"`
+	TLS     TLSConfig         `mapstructure:"tls"`
+}
+
+// RPCConfig tunes the shared HTTP client. Durations accept strings such as
+// "5s"; zero values use the client defaults.
+type RPCConfig struct {
+	MaxIdleConns          int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout       time.Duration `mapstructure:"idle_conn_timeout"`
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`
+	KeepAlive             time.Duration `mapstructure:"keep_alive"`
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	RequestTimeout        time.Duration `mapstructure:"request_timeout"`
+	BatchSize             int           `mapstructure:"batch_size"`
+}
+
+// HealthConfig controls liveness probes and per-node circuit breakers. Zero
+// values use the rpc defaults; a zero ProbeInterval disables probes.
+type HealthConfig struct {
+	ProbeInterval    time.Duration `mapstructure:"probe_interval"`
+	Window           int           `mapstructure:"window"`
+	MinRequests      int           `mapstructure:"min_requests"`
+	FailureRate      float64       `mapstructure:"failure_rate"`
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`
+	HalfOpenRequests int           `mapstructure:"half_open_requests"`
+}
+
+// RetryConfig is the retry policy for submissions. Strategy is exponential
+// (default), decorrelated_jitter or constant. Overrides are keyed by error
+// class: rate_limited, unavailable, timeout, transport, no_node or other.
+// Zero values use the rpc defaults.
+type RetryConfig struct {
+	Strategy    string                 `mapstructure:"strategy"`
+	MaxAttempts int                    `mapstructure:"max_attempts"`
+	BaseDelay   time.Duration          `mapstructure:"base_delay"`
+	MaxDelay    time.Duration          `mapstructure:"max_delay"`
+	Multiplier  float64                `mapstructure:"multiplier"`
+	MaxElapsed  time.Duration          `mapstructure:"max_elapsed"`
+	Overrides   map[string]RetryConfig `mapstructure:"overrides"`
+}
+
+// ChainConfig selects the JSON-RPC dialect the nodes speak.
+type ChainConfig struct {
+	// Type is xygle (default) or ethereum.
+	Type string `mapstructure:"type"`
+	// Confirmations, for ethereum, is the block depth at which a
+	// transaction counts as final. Zero uses the node's finalized block.
+	Confirmations uint64 `mapstructure:"confirmations"`
+}
+
+// PhaseConfig is one phase of a load profile. Type is ramp (Rate to To
+// linearly), step (Rate to To in Steps equal steps), or spike, soak or
+// constant (Rate throughout). Constant-rate phases may set Workers instead
+// of Rate to run closed-loop with that many concurrent submissions.
+type PhaseConfig struct {
+	Name     string        `mapstructure:"name"`
+	Type     string        `mapstructure:"type"`
+	Duration time.Duration `mapstructure:"duration"`
+	Rate     float64       `mapstructure:"rate"`
+	To       float64       `mapstructure:"to"`
+	Steps    int           `mapstructure:"steps"`
+	Workers  int           `mapstructure:"workers"`
+}
+
+// WorkloadConfig selects and configures the workload generating a run's
+// transfers. Name is a registered workload, transfer by default.
+type WorkloadConfig struct {
+	Name string `mapstructure:"name"`
+	// Receivers defaults to the single top-level receiver.
+	Receivers []string `mapstructure:"receivers"`
+	// Distribution is uniform (default) or zipf, with exponent ZipfS.
+	Distribution string      `mapstructure:"distribution"`
+	ZipfS        float64     `mapstructure:"zipf_s"`
+	Value        ValueConfig `mapstructure:"value"`
+	// Seed makes the sequence of transfers deterministic; zero uses the
+	// run's -seed.
+	Seed   int64                  `mapstructure:"seed"`
+	Params map[string]interface{} `mapstructure:"params"`
+}
+
+// ValueConfig is the distribution of transfer values: fixed (Value),
+// uniform (Min to Max) or normal (Mean, StdDev, kept within Min and Max).
+type ValueConfig struct {
+	Distribution string  `mapstructure:"distribution"`
+	Value        uint64  `mapstructure:"value"`
+	Min          uint64  `mapstructure:"min"`
+	Max          uint64  `mapstructure:"max"`
+	Mean         float64 `mapstructure:"mean"`
+	StdDev       float64 `mapstructure:"stddev"`
 }
 
 type AppConfig struct {
-	Node     NodeConfig `mapstructure:"node"`
-	Receiver string     `mapstructure:"receiver"`
+	Node     NodeConfig   `mapstructure:"node"`
+	Nodes    []NodeConfig `mapstructure:"nodes"`
+	Receiver string       `mapstructure:"receiver"`
+	RPC      RPCConfig    `mapstructure:"rpc"`
+	Health   HealthConfig `mapstructure:"health"`
+	Retry    RetryConfig  `mapstructure:"retry"`
+	// LoadBalancing is round_robin (default), least_outstanding or weighted.
+	LoadBalancing string `mapstructure:"load_balancing"`
+	// Keys lists key files, or directories of *.key files, to sign
+	// transfers with locally. When empty, nodes sign for their address.
+	Keys  []string    `mapstructure:"keys"`
+	Chain ChainConfig `mapstructure:"chain"`
+	// Profile, when set, makes a run a sequence of load phases instead of
+	// a fixed number of transactions.
+	Profile []PhaseConfig `mapstructure:"profile"`
+	// Workload generates the transfers of a run.
+	Workload WorkloadConfig `mapstructure:"workload"`
+}
+
+// NodeList returns the configured nodes, falling back to the single "node"
+// entry when "nodes" is empty.
+func (c *AppConfig) NodeList() []NodeConfig {
+	if len(c.Nodes) > 0 {
+		return c.Nodes
+	}
+	return []NodeConfig{c.Node}
 }
 
 func LoadConfig() (*AppConfig, error) {
@@ -36,5 +160,11 @@ func LoadConfig() (*AppConfig, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	// Unmarshal wraps negative numbers into unsigned fields
+	for _, key := range []string{"workload.value.value", "workload.value.min", "workload.value.max"} {
+		if v := viper.GetFloat64(key); v < 0 {
+			return nil, fmt.Errorf("%s must not be negative, got %v", key, v)
+		}
+	}
 	return &cfg, nil
 }
@@ -0,0 +1,155 @@
+package corpus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"metrics/models"
+	"metrics/rpc"
+	"sync"
+	"time"
+)
+
+type BlastOptions struct {
+	// Rate is the target number of submissions per second; zero sends as
+	// fast as the workers allow.
+	Rate    float64
+	Workers int
+	// Retry paces the attempts per entry on retryable errors; zero fields
+	// use rpc.DefaultRetryPolicy.
+	Retry rpc.RetryPolicy
+	// OnResult, if set, is called with each result as it completes.
+	OnResult func(Result)
+}
+
+type Result struct {
+	Seq     int
+	Sender  string
+	Nonce   uint64
+	TxID    string
+	Node    string
+	Success bool
+	Error   error
+	// Retries is the number of attempts after the first.
+	Retries int
+	// SentAt is when the first attempt was sent; Latency runs from there to
+	// the node's answer to the last attempt.
+	SentAt  time.Time
+	Latency time.Duration
+}
+
+// Blast streams the entries of r at the nodes of pool and returns the
+// result of every entry it sent. Entries are sent in corpus order, paced by
+// opts.Rate, with opts.Workers submissions in flight. It stops early when
+// ctx is cancelled or the corpus cannot be read.
+func Blast(ctx context.Context, client *rpc.Client, pool *rpc.NodePool, r *Reader, opts BlastOptions) ([]Result, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if err := opts.Retry.Validate(); err != nil {
+		return nil, err
+	}
+
+	entries := make(chan Entry, opts.Workers*2)
+	var readErr error
+	go func() {
+		defer close(entries)
+		start := time.Now()
+		for i := 0; ; i++ {
+			e, err := r.Next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			if opts.Rate > 0 {
+				due := start.Add(time.Duration(float64(i) / opts.Rate * float64(time.Second)))
+				if wait := time.Until(due); wait > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(wait):
+					}
+				}
+			}
+			select {
+			case entries <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		results []Result
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				res := send(ctx, client, pool, e, opts)
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+				if opts.OnResult != nil {
+					opts.OnResult(res)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if readErr != nil {
+		return results, readErr
+	}
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("blast interrupted: %v", err)
+	}
+	return results, nil
+}
+
+// send submits one entry, retrying retryable errors. Unsigned entries only
+// go to nodes that sign for their sender.
+func send(ctx context.Context, client *rpc.Client, pool *rpc.NodePool, e Entry, opts BlastOptions) Result {
+	var accept func(model.NodeInfo) bool
+	if !e.Signed {
+		accept = func(n model.NodeInfo) bool { return n.Address == e.Sender }
+	}
+
+	res := Result{Seq: e.Seq, Sender: e.Sender, Nonce: e.Nonce, SentAt: time.Now()}
+	backoff := opts.Retry.Start()
+	var err error
+	for {
+		var lease *rpc.Lease
+		lease, err = pool.Acquire(accept)
+		if err == nil {
+			res.Node = lease.Node.URL
+			res.TxID, err = client.SubmitTransaction(ctx, lease.Node, e.Method, e.Params)
+			lease.Release(err)
+			if err == nil {
+				res.Success = true
+				break
+			}
+		}
+		if ctx.Err() != nil || !(errors.Is(err, rpc.ErrNoNodeAvailable) || rpc.IsRetryable(err)) {
+			break
+		}
+		delay, ok := backoff.Next(err)
+		if !ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	res.Retries = backoff.Retries()
+	res.Latency = time.Since(res.SentAt)
+	res.Error = err
+	return res
+}
@@ -0,0 +1,92 @@
+// Package corpus builds transfer payloads ahead of time and replays them at
+// a node, so nonce allocation, encoding and signing stay out of the
+// measured submission path.
+package corpus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Entry is one pre-built submission. Params is the encoded params of Method,
+// ready to send.
+type Entry struct {
+	Seq      int             `json:"seq"`
+	Sender   string          `json:"sender"`
+	Receiver string          `json:"receiver"`
+	Value    uint64          `json:"value"`
+	Nonce    uint64          `json:"nonce"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params"`
+	// Signed is true for locally signed entries, which any node accepts.
+	// Unsigned entries must go to a node that signs for Sender.
+	Signed bool `json:"signed,omitempty"`
+}
+
+// Writer writes entries as JSON lines.
+type Writer struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (w *Writer) Write(e Entry) error {
+	return w.enc.Encode(e)
+}
+
+// Flush writes any buffered entries to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader streams entries from a corpus without loading it into memory.
+type Reader struct {
+	dec  *json.Decoder
+	file *os.File
+	line int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Open opens a corpus file for reading; Close releases it.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corpus: %w", err)
+	}
+	r := NewReader(f)
+	r.file = f
+	return r, nil
+}
+
+// Next returns the next entry, or io.EOF at the end of the corpus.
+func (r *Reader) Next() (Entry, error) {
+	var e Entry
+	if err := r.dec.Decode(&e); err != nil {
+		if err == io.EOF {
+			return Entry{}, io.EOF
+		}
+		return Entry{}, fmt.Errorf("corpus entry %d: %w", r.line+1, err)
+	}
+	r.line++
+	if e.Method == "" || len(e.Params) == 0 {
+		return Entry{}, fmt.Errorf("corpus entry %d: missing method or params", r.line)
+	}
+	return e, nil
+}
+
+func (r *Reader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
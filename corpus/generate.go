@@ -0,0 +1,70 @@
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"metrics/rpc"
+	"metrics/signer"
+)
+
+// Account is a sender of generated transfers. With a Key the transfers are
+// signed locally; without one they are left for the node to sign.
+type Account struct {
+	Address string
+	// NextNonce is the nonce of the account's first generated transfer.
+	NextNonce uint64
+	Key       *signer.Key
+}
+
+// Generate writes n transfers of value to receiver, spread round-robin over
+// accounts with consecutive nonces per account.
+func Generate(w *Writer, accounts []Account, receiver string, value uint64, n int) error {
+	if len(accounts) == 0 {
+		return fmt.Errorf("no sender accounts")
+	}
+	nonces := make([]uint64, len(accounts))
+	for i, acct := range accounts {
+		nonces[i] = acct.NextNonce
+	}
+
+	for seq := 1; seq <= n; seq++ {
+		i := (seq - 1) % len(accounts)
+		acct := accounts[i]
+		e := Entry{
+			Seq:      seq,
+			Sender:   acct.Address,
+			Receiver: receiver,
+			Value:    value,
+			Nonce:    nonces[i],
+		}
+		nonces[i]++
+
+		var params map[string]interface{}
+		if acct.Key != nil {
+			signed, err := acct.Key.Sign(signer.Transaction{
+				Sender:   acct.Address,
+				Receiver: receiver,
+				Value:    value,
+				Nonce:    e.Nonce,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to sign entry %d: %w", seq, err)
+			}
+			e.Method = "xygle_sendRawTransaction"
+			e.Signed = true
+			params = rpc.RawTransactionParams(signed.Raw())
+		} else {
+			e.Method = "xygle_transferFund"
+			params = rpc.TransferParams(receiver, value, e.Nonce)
+		}
+
+		var err error
+		if e.Params, err = json.Marshal(params); err != nil {
+			return err
+		}
+		if err := w.Write(e); err != nil {
+			return fmt.Errorf("failed to write entry %d: %w", seq, err)
+		}
+	}
+	return w.Flush()
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -9,6 +10,8 @@ var (
 	Info    *log.Logger
 	Error   *log.Logger
 	Metrics *log.Logger
+
+	metricsFile *os.File
 )
 
 func Init() {
@@ -21,5 +24,36 @@ func Init() {
 		log.Fatalf("Failed to open metrics log file: %v", err)
 	}
 
+	metricsFile = file
 	Metrics = log.New(file, "METRIC: ", log.Ldate|log.Ltime)
 }
+
+// Sync flushes the metrics log to disk.
+func Sync() error {
+	if metricsFile == nil {
+		return nil
+	}
+	return metricsFile.Sync()
+}
+
+// Close flushes and closes the metrics log. Later metrics are discarded.
+func Close() error {
+	if metricsFile == nil {
+		return nil
+	}
+	Metrics.SetOutput(io.Discard)
+	err := metricsFile.Sync()
+	if cerr := metricsFile.Close(); err == nil {
+		err = cerr
+	}
+	metricsFile = nil
+	return err
+}
+
+// InitDiscard sets up the loggers without output or a metrics file, for
+// tests.
+func InitDiscard() {
+	Info = log.New(io.Discard, "INFO: ", 0)
+	Error = log.New(io.Discard, "ERROR: ", 0)
+	Metrics = log.New(io.Discard, "METRIC: ", 0)
+}
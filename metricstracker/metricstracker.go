@@ -1,160 +1,647 @@
 package metricstracker
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"metrics/logger"
 	"metrics/models"
 	"metrics/rpc"
-	"sort"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 )
 
+// DetectionMode records how a status change was observed.
+type DetectionMode string
+
+const (
+	DetectedByPoll  DetectionMode = "poll"
+	DetectedByEvent DetectionMode = "event"
+)
+
+const maxEarlyEvents = 10000
+
 type txTimes struct {
+	node       model.NodeInfo
 	submitted  time.Time
+	intended   time.Time
 	executed   time.Time
 	finalized  time.Time
 	execUnix   int64
 	execStatus string
+	execMode   DetectionMode
+	finalMode  DetectionMode
+	// failed is set when the transaction executed but failed; it is not
+	// waited on any further.
+	failed bool
+	phase  string
+}
+
+// earlyEvent is a status event for a transaction that has not been marked
+// submitted yet, which happens when the node notifies before the submission
+// call returns.
+type earlyEvent struct {
+	status rpc.TxStatus
+	at     time.Time
 }
 
 type Tracker struct {
-	node      model.NodeInfo
-	times     map[string]*txTimes
-	pollEvery time.Duration
-	timeout   time.Duration
+	adapter        rpc.ChainAdapter
+	nodes          []model.NodeInfo
+	mu             sync.Mutex
+	times          map[string]*txTimes
+	early          map[string][]earlyEvent
+	pollEvery      time.Duration
+	eventPollEvery time.Duration
+	timeout        time.Duration
+	// phases lists the load profile phases seen by Track, in order.
+	phases []string
+	// dropCompleted makes observe fold final and failed transactions into
+	// retired and forget them.
+	dropCompleted bool
+	retired       tally
+	retiredPhases map[string]*tally
+
+	// senders are the accounts whose events are subscribed to; empty means
+	// each node's own address.
+	senders       []string
+	streams       []*rpc.StatusStream
+	activeStreams int
+	closing       bool
+	// updated is signalled whenever an event changes a transaction's state,
+	// so WaitAndCollect can return without waiting for the next poll tick.
+	updated chan struct{}
 }
 
 type Summary struct {
 	LatencySeconds        map[string]float64
 	TimeToFinalSeconds    map[string]float64
 	ExecUnixTimestamps    map[string]int64
+	LatencyDetection      map[string]DetectionMode
+	FinalDetection        map[string]DetectionMode
 	AvgLatencySeconds     float64
 	AvgTimeToFinalSeconds float64
 	TPS                   float64
 	ExecutedCount         int
 	FinalizedCount        int
+	// FailedCount is the number of transactions that executed but failed.
+	FailedCount int
+	// CorrectedLatencySeconds runs from the intended start of each
+	// scheduled transaction instead of its actual submission, so delays in
+	// sending are not hidden (coordinated omission).
+	CorrectedLatencySeconds map[string]float64
+	// AvgCorrectedLatencySeconds averages CorrectedLatencySeconds; it
+	// equals AvgLatencySeconds when nothing was scheduled.
+	AvgCorrectedLatencySeconds float64
+	// ScheduledCount is the number of tracked transactions that had an
+	// intended start time.
+	ScheduledCount int
+	// Phases breaks the run down by load profile phase, in the order the
+	// phases ran. It is empty outside profile runs.
+	Phases []PhaseSummary
+}
+
+// PhaseSummary holds the metrics of the transactions sent during one load
+// profile phase.
+type PhaseSummary struct {
+	Name                       string
+	TrackedCount               int
+	ExecutedCount              int
+	FinalizedCount             int
+	FailedCount                int
+	AvgLatencySeconds          float64
+	AvgCorrectedLatencySeconds float64
+	// P95CorrectedLatencySeconds is the 95th percentile of corrected
+	// latency, which shows degradation earlier than the average.
+	P95CorrectedLatencySeconds float64
+	AvgTimeToFinalSeconds      float64
+	TPS                        float64
 }
 
-func NewTracker(node model.NodeInfo) *Tracker {
+// Submission is a transaction accepted by a node, to be tracked.
+type Submission struct {
+	TxID string
+	// Node is the URL of the node that accepted the transaction.
+	Node string
+	// SubmittedAt is when the first attempt was sent.
+	SubmittedAt time.Time
+	// IntendedAt is when an open-loop schedule meant the transaction to be
+	// sent. Zero means SubmittedAt.
+	IntendedAt time.Time
+	// Phase is the load profile phase the transaction was sent in, if any.
+	Phase string
+}
+
+// NewTracker tracks transactions submitted to any of nodes, reading their
+// status through adapter. Each transaction is polled on the node that
+// accepted it.
+func NewTracker(adapter rpc.ChainAdapter, nodes []model.NodeInfo) *Tracker {
 	return &Tracker{
-		node:      node,
-		times:     make(map[string]*txTimes),
-		pollEvery: 2 * time.Second,
-		timeout:   5 * time.Minute,
+		adapter:        adapter,
+		nodes:          nodes,
+		times:          make(map[string]*txTimes),
+		early:          make(map[string][]earlyEvent),
+		pollEvery:      2 * time.Second,
+		eventPollEvery: 15 * time.Second,
+		timeout:        5 * time.Minute,
+		updated:        make(chan struct{}, 1),
+		retiredPhases:  make(map[string]*tally),
 	}
 }
 
-func (t *Tracker) MarkSubmitted(txID string, at time.Time) {
-	t.times[txID] = &txTimes{submitted: at}
+// SetTimeout bounds how long WaitAndCollect keeps collecting once
+// submission has stopped. The default is five minutes.
+func (t *Tracker) SetTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeout = d
 }
 
-func (t *Tracker) WaitAndCollect() (int, int) {
-	deadline := time.Now().Add(t.timeout)
-	executed := 0
-	final := 0
-
-	pending := func() []string {
-		var ids []string
-		for id, tt := range t.times {
-			if tt.executed.IsZero() || tt.finalized.IsZero() {
-				ids = append(ids, id)
-			}
+// DropCompleted makes the tracker fold each transaction into the summary
+// totals and forget it once it is final or has failed, so memory stays flat
+// however long a run lasts. The per-transaction maps of Summary then only
+// cover transactions still in flight.
+func (t *Tracker) DropCompleted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropCompleted = true
+}
+
+// MarkSubmitted starts tracking txID, accepted by the node with URL nodeURL at
+// time at.
+func (t *Tracker) MarkSubmitted(txID string, nodeURL string, at time.Time) {
+	t.Track(Submission{TxID: txID, Node: nodeURL, SubmittedAt: at})
+}
+
+// Track starts tracking the transaction of sub.
+func (t *Tracker) Track(sub Submission) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := model.NodeInfo{URL: sub.Node}
+	for _, n := range t.nodes {
+		if n.URL == sub.Node {
+			node = n
+			break
 		}
-		return ids
 	}
 
-	for {
-		if len(pending()) == 0 || time.Now().After(deadline) {
-			break
+	t.times[sub.TxID] = &txTimes{node: node, submitted: sub.SubmittedAt, intended: sub.IntendedAt, phase: sub.Phase}
+	if sub.Phase != "" && !slices.Contains(t.phases, sub.Phase) {
+		t.phases = append(t.phases, sub.Phase)
+	}
+	early := t.early[sub.TxID]
+	for _, ev := range early {
+		t.observe(sub.TxID, ev.status, ev.at, DetectedByEvent)
+	}
+	delete(t.early, sub.TxID)
+	if len(early) > 0 {
+		select {
+		case t.updated <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// WatchSenders makes ListenForEvents subscribe to the transactions of
+// addresses instead of each node's own address. Call it before
+// ListenForEvents when transactions are signed locally.
+func (t *Tracker) WatchSenders(addresses []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.senders = append([]string(nil), addresses...)
+}
+
+// ListenForEvents subscribes to transaction status events on the WebSocket
+// endpoint of every node that has one, if the chain adapter supports it.
+// While any stream is up, WaitAndCollect only polls as a safety net; once all
+// of them drop, polling takes over. It returns the first subscription error,
+// after trying every node. ctx bounds the lifetime of the streams.
+func (t *Tracker) ListenForEvents(ctx context.Context) error {
+	subscriber, ok := t.adapter.(rpc.StatusSubscriber)
+	if !ok {
+		return fmt.Errorf("%s adapter does not support status subscriptions", t.adapter.Name())
+	}
+
+	var firstErr error
+	for _, node := range t.nodes {
+		if node.WSURL == "" {
+			continue
+		}
+		if err := t.listen(ctx, subscriber, node); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *Tracker) listen(ctx context.Context, subscriber rpc.StatusSubscriber, node model.NodeInfo) error {
+	t.mu.Lock()
+	addresses := t.senders
+	t.mu.Unlock()
+	if len(addresses) == 0 {
+		addresses = []string{node.Address}
+	}
+
+	stream, err := subscriber.SubscribeStatuses(ctx, node, addresses)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.streams = append(t.streams, stream)
+	t.activeStreams++
+	t.mu.Unlock()
+
+	logger.Metrics.Printf("Tracking transaction status via WebSocket events from %s (%d senders)", node.WSURL, len(addresses))
+	go t.consumeEvents(ctx, node.WSURL, stream.Events)
+	return nil
+}
+
+// Close cancels the event subscriptions, if any.
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	streams := t.streams
+	t.streams = nil
+	t.closing = true
+	t.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.Close()
+	}
+}
+
+func (t *Tracker) consumeEvents(ctx context.Context, url string, events <-chan rpc.TxStatus) {
+	defer func() {
+		t.mu.Lock()
+		t.activeStreams--
+		closing := t.closing
+		t.mu.Unlock()
+		if ctx.Err() == nil && !closing {
+			logger.Metrics.Printf("Event stream from %s ended, falling back to polling", url)
 		}
+	}()
 
-		for _, txID := range pending() {
-			detail, err := rpc.GetTransactionDetails(t.node, txID)
-			if err != nil {
-				if !strings.Contains(strings.ToLower(err.Error()), "not found") {
-					logger.Error.Printf("poll %s error: %v", txID, err)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status, ok := <-events:
+			if !ok {
+				return
+			}
+			now := time.Now()
+			t.mu.Lock()
+			if _, known := t.times[status.ID]; known {
+				t.observe(status.ID, status, now, DetectedByEvent)
+				select {
+				case t.updated <- struct{}{}:
+				default:
 				}
-				continue
+			} else if len(t.early) < maxEarlyEvents {
+				t.early[status.ID] = append(t.early[status.ID], earlyEvent{status: status, at: now})
 			}
+			t.mu.Unlock()
+		}
+	}
+}
 
-			tt := t.times[txID]
-			if detail.ExecutionStatus == "SUCCESS" && tt.executed.IsZero() {
-				tt.executed = time.Now()
-				tt.execUnix = detail.ExecutionTimestamp
-				tt.execStatus = detail.ExecutionStatus
-				executed++
-				logger.Metrics.Printf("Tx %s executed (status=%s)", txID, detail.ExecutionStatus)
-			}
-			if detail.IsFinal && tt.finalized.IsZero() {
-				tt.finalized = time.Now()
-				final++
-				logger.Metrics.Printf("Tx %s is final =%t)", txID, detail.IsFinal)
+// observe records execution, failure and finality seen at time at. Callers
+// hold t.mu.
+func (t *Tracker) observe(txID string, status rpc.TxStatus, at time.Time, mode DetectionMode) {
+	tt, ok := t.times[txID]
+	if !ok {
+		return
+	}
+	switch status.Status {
+	case rpc.StatusFailed:
+		if !tt.failed {
+			tt.failed = true
+			tt.execStatus = status.Detail
+			logger.Metrics.Printf("Tx %s failed (status=%s, detected by %s)", txID, status.Detail, mode)
+		}
+	case rpc.StatusExecuted, rpc.StatusFinal:
+		if tt.executed.IsZero() {
+			tt.executed = at
+			tt.execUnix = status.ExecutedAt
+			tt.execStatus = status.Detail
+			tt.execMode = mode
+			logger.Metrics.Printf("Tx %s executed (status=%s, detected by %s)", txID, status.Detail, mode)
+		}
+		if status.Status == rpc.StatusFinal && tt.finalized.IsZero() {
+			tt.finalized = at
+			tt.finalMode = mode
+			logger.Metrics.Printf("Tx %s is final (detected by %s)", txID, mode)
+		}
+	}
+
+	if t.dropCompleted && (tt.failed || !tt.finalized.IsZero()) {
+		t.retired.add(tt)
+		if tt.phase != "" {
+			if t.retiredPhases[tt.phase] == nil {
+				t.retiredPhases[tt.phase] = &tally{}
 			}
+			t.retiredPhases[tt.phase].add(tt)
 		}
+		delete(t.times, txID)
+	}
+}
 
-		time.Sleep(t.pollEvery)
+// pending groups unfinished transactions by the node that accepted them.
+func (t *Tracker) pending() (map[string][]string, map[string]model.NodeInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make(map[string][]string)
+	nodes := make(map[string]model.NodeInfo)
+	for id, tt := range t.times {
+		if !tt.failed && (tt.executed.IsZero() || tt.finalized.IsZero()) {
+			ids[tt.node.URL] = append(ids[tt.node.URL], id)
+			nodes[tt.node.URL] = tt.node
+		}
 	}
+	return ids, nodes
+}
 
+func (t *Tracker) counts() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	executed, final := t.retired.executed, t.retired.finalized
+	for _, tt := range t.times {
+		if !tt.executed.IsZero() {
+			executed++
+		}
+		if !tt.finalized.IsZero() {
+			final++
+		}
+	}
 	return executed, final
 }
 
+// WaitAndCollect waits until tracked transactions are final or failed, the
+// timeout elapses or ctx is cancelled. It polls the node unless an event
+// stream is active, and returns the executed and finalized totals.
+func (t *Tracker) WaitAndCollect(ctx context.Context) (int, int) {
+	t.mu.Lock()
+	deadline := time.Now().Add(t.timeout)
+	t.mu.Unlock()
+	var lastPoll time.Time
+
+	for {
+		ids, nodes := t.pending()
+		if len(ids) == 0 || time.Now().After(deadline) || ctx.Err() != nil {
+			break
+		}
+		lastPoll = t.pollPending(ctx, ids, nodes, lastPoll)
+
+		select {
+		case <-ctx.Done():
+		case <-t.updated:
+		case <-time.After(t.pollEvery):
+		}
+	}
+
+	return t.counts()
+}
+
+// Follow keeps polling tracked transactions until stop is closed or ctx is
+// done, so that statuses are observed while a long run is still
+// submitting. Unlike WaitAndCollect it does not return when nothing is
+// pending.
+func (t *Tracker) Follow(ctx context.Context, stop <-chan bool) {
+	var lastPoll time.Time
+	for {
+		ids, nodes := t.pending()
+		if len(ids) > 0 {
+			lastPoll = t.pollPending(ctx, ids, nodes, lastPoll)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(t.pollEvery):
+		}
+	}
+}
+
+// pollPending polls ids on their nodes, unless an event stream is up and
+// the last poll was recent. It returns the time of the last poll.
+func (t *Tracker) pollPending(ctx context.Context, ids map[string][]string, nodes map[string]model.NodeInfo, lastPoll time.Time) time.Time {
+	t.mu.Lock()
+	events := t.activeStreams > 0
+	t.mu.Unlock()
+
+	if events && time.Since(lastPoll) < t.eventPollEvery {
+		return lastPoll
+	}
+	for url, txIDs := range ids {
+		t.poll(ctx, nodes[url], txIDs)
+	}
+	return time.Now()
+}
+
+func (t *Tracker) poll(ctx context.Context, node model.NodeInfo, txIDs []string) {
+	results := t.adapter.GetStatuses(ctx, node, txIDs)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for txID, res := range results {
+		if res.Err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(res.Err, rpc.ErrNotFound) {
+				logger.Error.Printf("poll %s error: %v", txID, res.Err)
+			}
+			continue
+		}
+		t.observe(txID, res.Status, now, DetectedByPoll)
+	}
+}
+
 func (t *Tracker) Summarize() (Summary, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	s := Summary{
-		LatencySeconds:     map[string]float64{},
-		TimeToFinalSeconds: map[string]float64{},
-		ExecUnixTimestamps: map[string]int64{},
+		LatencySeconds:          map[string]float64{},
+		CorrectedLatencySeconds: map[string]float64{},
+		TimeToFinalSeconds:      map[string]float64{},
+		ExecUnixTimestamps:      map[string]int64{},
+		LatencyDetection:        map[string]DetectionMode{},
+		FinalDetection:          map[string]DetectionMode{},
+	}
+
+	// Dropped transactions only survive in the retired tallies
+	total := t.retired.clone()
+	phases := make(map[string]*tally, len(t.phases))
+	for _, phase := range t.phases {
+		pt := &tally{}
+		if retired := t.retiredPhases[phase]; retired != nil {
+			*pt = retired.clone()
+		}
+		phases[phase] = pt
 	}
-	var latVals []float64
-	var finVals []float64
 
-	var execTs []int64
 	for id, tt := range t.times {
+		total.add(tt)
+		if pt := phases[tt.phase]; pt != nil {
+			pt.add(tt)
+		}
 		if !tt.executed.IsZero() && !tt.submitted.IsZero() {
-			lat := tt.executed.Sub(tt.submitted).Seconds()
-			s.LatencySeconds[id] = lat
-			latVals = append(latVals, lat)
+			s.LatencySeconds[id] = tt.executed.Sub(tt.submitted).Seconds()
+			s.CorrectedLatencySeconds[id] = tt.correctedLatency()
+			s.LatencyDetection[id] = tt.execMode
 			s.ExecUnixTimestamps[id] = tt.execUnix
-			if tt.execUnix > 0 {
-				execTs = append(execTs, tt.execUnix)
-			}
-			s.ExecutedCount++
 		}
 		if !tt.finalized.IsZero() && !tt.submitted.IsZero() {
-			final := tt.finalized.Sub(tt.submitted).Seconds()
-			s.TimeToFinalSeconds[id] = final
-			finVals = append(finVals, final)
-			s.FinalizedCount++
+			s.TimeToFinalSeconds[id] = tt.finalized.Sub(tt.submitted).Seconds()
+			s.FinalDetection[id] = tt.finalMode
 		}
 	}
 
-	if len(latVals) > 0 {
-		var sum float64
-		for _, v := range latVals {
-			sum += v
-		}
-		s.AvgLatencySeconds = sum / float64(len(latVals))
+	all := total.summary("")
+	s.ExecutedCount = all.ExecutedCount
+	s.FinalizedCount = all.FinalizedCount
+	s.FailedCount = all.FailedCount
+	s.ScheduledCount = total.scheduled
+	s.AvgLatencySeconds = all.AvgLatencySeconds
+	s.AvgCorrectedLatencySeconds = all.AvgCorrectedLatencySeconds
+	s.AvgTimeToFinalSeconds = all.AvgTimeToFinalSeconds
+	s.TPS = all.TPS
+	for _, phase := range t.phases {
+		s.Phases = append(s.Phases, phases[phase].summary(phase))
 	}
-	if len(finVals) > 0 {
-		var sum float64
-		for _, v := range finVals {
-			sum += v
+
+	if total.execCount == 0 {
+		return s, errors.New("no executed transactions to compute TPS")
+	}
+	return s, nil
+}
+
+// correctedLatency is the execution latency measured from the intended
+// start, or from submission if there was none.
+func (tt *txTimes) correctedLatency() float64 {
+	if tt.intended.IsZero() {
+		return tt.executed.Sub(tt.submitted).Seconds()
+	}
+	return tt.executed.Sub(tt.intended).Seconds()
+}
+
+// tally accumulates the summary figures of a set of transactions in
+// constant space.
+type tally struct {
+	tracked, executed, finalized, failed, scheduled int
+	latSum, corrSum, finSum                         float64
+	corrected                                       histogram
+	// execCount, minExec and maxExec cover executions with a chain
+	// timestamp, for TPS.
+	execCount        int
+	minExec, maxExec int64
+}
+
+func (tl *tally) add(tt *txTimes) {
+	tl.tracked++
+	if tt.failed {
+		tl.failed++
+	}
+	if !tt.intended.IsZero() {
+		tl.scheduled++
+	}
+	if !tt.executed.IsZero() && !tt.submitted.IsZero() {
+		tl.executed++
+		tl.latSum += tt.executed.Sub(tt.submitted).Seconds()
+		corrected := tt.correctedLatency()
+		tl.corrSum += corrected
+		if tl.corrected == nil {
+			tl.corrected = histogram{}
+		}
+		tl.corrected.add(corrected)
+		if tt.execUnix > 0 {
+			if tl.execCount == 0 || tt.execUnix < tl.minExec {
+				tl.minExec = tt.execUnix
+			}
+			if tt.execUnix > tl.maxExec {
+				tl.maxExec = tt.execUnix
+			}
+			tl.execCount++
 		}
-		s.AvgTimeToFinalSeconds = sum / float64(len(finVals))
 	}
+	if !tt.finalized.IsZero() && !tt.submitted.IsZero() {
+		tl.finalized++
+		tl.finSum += tt.finalized.Sub(tt.submitted).Seconds()
+	}
+}
 
-	if len(execTs) == 0 {
-		return s, errors.New("no executed transactions to compute TPS")
+func (tl tally) clone() tally {
+	tl.corrected = maps.Clone(tl.corrected)
+	return tl
+}
+
+func (tl tally) summary(name string) PhaseSummary {
+	ps := PhaseSummary{
+		Name:           name,
+		TrackedCount:   tl.tracked,
+		ExecutedCount:  tl.executed,
+		FinalizedCount: tl.finalized,
+		FailedCount:    tl.failed,
+	}
+	if tl.executed > 0 {
+		ps.AvgLatencySeconds = tl.latSum / float64(tl.executed)
+		ps.AvgCorrectedLatencySeconds = tl.corrSum / float64(tl.executed)
+		ps.P95CorrectedLatencySeconds = tl.corrected.quantile(0.95)
+	}
+	if tl.finalized > 0 {
+		ps.AvgTimeToFinalSeconds = tl.finSum / float64(tl.finalized)
 	}
-	sort.Slice(execTs, func(i, j int) bool { return execTs[i] < execTs[j] })
-	minTs := execTs[0]
-	maxTs := execTs[len(execTs)-1]
-	span := maxTs - minTs
-	if span <= 0 {
-		s.TPS = float64(len(execTs))
+	// Executions per second between the first and last chain timestamps,
+	// or the count if they fall in the same second
+	if span := tl.maxExec - tl.minExec; span > 0 {
+		ps.TPS = float64(tl.execCount) / float64(span)
 	} else {
-		s.TPS = float64(len(execTs)) / float64(span)
+		ps.TPS = float64(tl.execCount)
 	}
+	return ps
+}
 
-	return s, nil
+// histogram counts latencies in buckets 1% wide, so quantiles are accurate
+// to 1% whatever the number of samples.
+type histogram map[int]int
+
+const histogramGrowth = 1.01
+
+func (h histogram) add(seconds float64) {
+	bucket := math.MinInt32
+	if seconds > 0 {
+		bucket = int(math.Ceil(math.Log(seconds) / math.Log(histogramGrowth)))
+	}
+	h[bucket]++
+}
+
+// quantile returns the upper bound of the bucket holding quantile q.
+func (h histogram) quantile(q float64) float64 {
+	var total int
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q * float64(total)))
+	seen := 0
+	for _, bucket := range slices.Sorted(maps.Keys(h)) {
+		seen += h[bucket]
+		if seen >= rank {
+			if bucket == math.MinInt32 {
+				return 0
+			}
+			return math.Pow(histogramGrowth, float64(bucket))
+		}
+	}
+	return 0
 }
@@ -0,0 +1,184 @@
+package metricstracker
+
+import (
+	"context"
+	"metrics/logger"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitDiscard()
+	os.Exit(m.Run())
+}
+
+// newTestTracker starts a mock node and a tracker for it.
+func newTestTracker(t *testing.T, cfg rpctest.Config) (*rpctest.Server, rpc.ChainAdapter, *Tracker) {
+	t.Helper()
+	srv := rpctest.NewServer(cfg)
+	t.Cleanup(srv.Close)
+	client := rpc.NewClient(rpc.ClientConfig{})
+	t.Cleanup(client.CloseIdleConnections)
+	adapter := rpc.NewXygleAdapter(client)
+	return srv, adapter, NewTracker(adapter, []model.NodeInfo{srv.Node()})
+}
+
+// submit sends n transfers from the node's account and returns their IDs
+// with their submission times.
+func submit(t *testing.T, adapter rpc.ChainAdapter, node model.NodeInfo, n int) ([]string, []time.Time) {
+	t.Helper()
+	var ids []string
+	var times []time.Time
+	for nonce := uint64(1); nonce <= uint64(n); nonce++ {
+		at := time.Now()
+		txID, err := adapter.SubmitTransfer(context.Background(), node, rpc.Transfer{
+			Sender:   node.Address,
+			Receiver: "0xreceiver",
+			Value:    1,
+			Nonce:    nonce,
+		})
+		if err != nil {
+			t.Fatalf("submit nonce %d: %v", nonce, err)
+		}
+		ids = append(ids, txID)
+		times = append(times, at)
+	}
+	return ids, times
+}
+
+func TestPollingTracksToFinality(t *testing.T) {
+	srv, adapter, tracker := newTestTracker(t, rpctest.Config{
+		ExecutionDelay: rpctest.Fixed(30 * time.Millisecond),
+		FinalityDelay:  rpctest.Fixed(30 * time.Millisecond),
+	})
+	tracker.pollEvery = 20 * time.Millisecond
+	tracker.SetTimeout(10 * time.Second)
+
+	ids, times := submit(t, adapter, srv.Node(), 10)
+	for i, id := range ids {
+		tracker.MarkSubmitted(id, srv.URL(), times[i])
+	}
+	executed, finalized := tracker.WaitAndCollect(context.Background())
+	if executed != 10 || finalized != 10 {
+		t.Fatalf("WaitAndCollect() = %d executed, %d finalized; want 10, 10", executed, finalized)
+	}
+
+	summary, err := tracker.Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if mode := summary.LatencyDetection[id]; mode != DetectedByPoll {
+			t.Errorf("execution of %s detected by %q, want poll", id, mode)
+		}
+		if summary.LatencySeconds[id] <= 0 || summary.TimeToFinalSeconds[id] < summary.LatencySeconds[id] {
+			t.Errorf("%s: latency %vs, time to final %vs", id, summary.LatencySeconds[id], summary.TimeToFinalSeconds[id])
+		}
+	}
+}
+
+func TestWaitAndCollectTimesOut(t *testing.T) {
+	// The node never executes within the tracker's timeout
+	srv, adapter, tracker := newTestTracker(t, rpctest.Config{ExecutionDelay: rpctest.Fixed(time.Hour)})
+	tracker.pollEvery = 20 * time.Millisecond
+	tracker.SetTimeout(100 * time.Millisecond)
+
+	ids, times := submit(t, adapter, srv.Node(), 1)
+	tracker.MarkSubmitted(ids[0], srv.URL(), times[0])
+	start := time.Now()
+	executed, finalized := tracker.WaitAndCollect(context.Background())
+	if executed != 0 || finalized != 0 {
+		t.Errorf("WaitAndCollect() = %d executed, %d finalized; want 0, 0", executed, finalized)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("WaitAndCollect took %v with a 100ms timeout", elapsed)
+	}
+}
+
+func TestEventsTrackToFinality(t *testing.T) {
+	srv, adapter, tracker := newTestTracker(t, rpctest.Config{
+		ExecutionDelay: rpctest.Fixed(30 * time.Millisecond),
+		FinalityDelay:  rpctest.Fixed(30 * time.Millisecond),
+	})
+	// Polling only as a late safety net, so the events must do the work
+	tracker.pollEvery = time.Hour
+	tracker.eventPollEvery = time.Hour
+	tracker.SetTimeout(10 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracker.ListenForEvents(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	ids, times := submit(t, adapter, srv.Node(), 5)
+	for i, id := range ids {
+		tracker.MarkSubmitted(id, srv.URL(), times[i])
+	}
+	executed, finalized := tracker.WaitAndCollect(ctx)
+	if executed != 5 || finalized != 5 {
+		t.Fatalf("WaitAndCollect() = %d executed, %d finalized; want 5, 5", executed, finalized)
+	}
+	summary, err := tracker.Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if summary.LatencyDetection[id] != DetectedByEvent || summary.FinalDetection[id] != DetectedByEvent {
+			t.Errorf("%s detected by %q/%q, want events", id, summary.LatencyDetection[id], summary.FinalDetection[id])
+		}
+	}
+}
+
+// Events for a transaction that is not tracked yet, because the node
+// notified before the submission call returned, are applied once it is.
+func TestEventsBeforeTrackAreKept(t *testing.T) {
+	srv, adapter, tracker := newTestTracker(t, rpctest.Config{})
+	tracker.pollEvery = time.Hour
+	tracker.eventPollEvery = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracker.ListenForEvents(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	ids, times := submit(t, adapter, srv.Node(), 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tracker.mu.Lock()
+		early := len(tracker.early[ids[0]])
+		tracker.mu.Unlock()
+		if early >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d early events buffered, want execution and finality", early)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tracker.MarkSubmitted(ids[0], srv.URL(), times[0])
+	// WaitAndCollect must not sleep out a poll interval before it notices
+	select {
+	case <-tracker.updated:
+	default:
+		t.Error("Track applied early events without signalling an update")
+	}
+	executed, finalized := tracker.counts()
+	if executed != 1 || finalized != 1 {
+		t.Errorf("after Track, %d executed and %d finalized, want 1, 1", executed, finalized)
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if len(tracker.early) != 0 {
+		t.Errorf("%d early event lists left after Track", len(tracker.early))
+	}
+	if mode := tracker.times[ids[0]].execMode; mode != DetectedByEvent {
+		t.Errorf("execution detected by %q, want event", mode)
+	}
+}
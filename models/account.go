@@ -0,0 +1,131 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// AccountState is the result of xygle_getAccountState. Nonce and Balance
+// accept JSON numbers as well as decimal or 0x-prefixed hex strings, and are
+// decoded without going through float64.
+type AccountState struct {
+	Address string
+	// Nonce is the nonce of the last executed transaction; the next
+	// transaction uses Nonce+1.
+	Nonce   uint64
+	Balance *big.Int
+	// Extra holds any other fields the node returned, undecoded.
+	Extra map[string]json.RawMessage
+}
+
+func (s *AccountState) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return fmt.Errorf("account state: null result")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("account state: expected an object: %w", err)
+	}
+
+	var state AccountState
+	if raw, ok := fields["address"]; ok {
+		if err := json.Unmarshal(raw, &state.Address); err != nil {
+			return fmt.Errorf("account state: address: expected a string, got %s", raw)
+		}
+		delete(fields, "address")
+	}
+
+	raw, ok := fields["nonce"]
+	if !ok {
+		return fmt.Errorf("account state: missing nonce")
+	}
+	n, err := decodeBigInt(raw)
+	if err != nil {
+		return fmt.Errorf("account state: nonce: %w", err)
+	}
+	if !n.IsUint64() {
+		return fmt.Errorf("account state: nonce: %s does not fit in uint64", n)
+	}
+	state.Nonce = n.Uint64()
+	delete(fields, "nonce")
+
+	raw, ok = fields["balance"]
+	if !ok {
+		return fmt.Errorf("account state: missing balance")
+	}
+	if state.Balance, err = decodeBigInt(raw); err != nil {
+		return fmt.Errorf("account state: balance: %w", err)
+	}
+	delete(fields, "balance")
+
+	if len(fields) > 0 {
+		state.Extra = fields
+	}
+	*s = state
+	return nil
+}
+
+func (s AccountState) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(s.Extra)+3)
+	for k, v := range s.Extra {
+		out[k] = v
+	}
+	out["address"] = s.Address
+	out["nonce"] = s.Nonce
+	balance := "0"
+	if s.Balance != nil {
+		balance = s.Balance.String()
+	}
+	out["balance"] = json.Number(balance)
+	return json.Marshal(out)
+}
+
+// decodeBigInt decodes a non-negative integer given as a JSON number or as
+// a decimal or 0x-prefixed hex string.
+func decodeBigInt(raw json.RawMessage) (*big.Int, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	var text string
+	base := 10
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+			text, base = text[2:], 16
+		}
+	} else {
+		var num json.Number
+		if err := json.Unmarshal(raw, &num); err != nil {
+			return nil, fmt.Errorf("expected a number or string, got %s", raw)
+		}
+		text = num.String()
+		// Accept integral values written with an exponent, such as 1e+21.
+		if strings.ContainsAny(text, ".eE") {
+			f, _, err := big.ParseFloat(text, 10, 256, big.ToNearestEven)
+			if err != nil || !f.IsInt() {
+				return nil, fmt.Errorf("%s is not an integer", text)
+			}
+			text = f.Text('f', 0)
+		}
+	}
+
+	if text == "" {
+		return nil, fmt.Errorf("empty value")
+	}
+	n, ok := new(big.Int).SetString(text, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", text)
+	}
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("negative value %s", n)
+	}
+	return n, nil
+}
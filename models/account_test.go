@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAccountStateDecoding(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		json    string
+		nonce   uint64
+		balance string
+		extra   []string
+		err     string // substring naming the field, if decoding must fail
+	}{
+		{name: "numbers", json: `{"address":"0xa","nonce":5,"balance":100}`, nonce: 5, balance: "100"},
+		{name: "string nonce", json: `{"nonce":"7","balance":"1"}`, nonce: 7, balance: "1"},
+		{name: "hex nonce", json: `{"nonce":"0x10","balance":"1"}`, nonce: 16, balance: "1"},
+		{name: "nonce above 2^53", json: `{"nonce":9007199254740993,"balance":0}`, nonce: 9007199254740993, balance: "0"},
+		{name: "balance above 2^64", json: `{"nonce":1,"balance":123456789012345678901234567890}`, nonce: 1, balance: "123456789012345678901234567890"},
+		{name: "hex balance", json: `{"nonce":1,"balance":"0xff"}`, nonce: 1, balance: "255"},
+		{name: "decimal string balance", json: `{"nonce":1,"balance":"255"}`, nonce: 1, balance: "255"},
+		{name: "exponent balance", json: `{"nonce":1,"balance":1e+21}`, nonce: 1, balance: "1000000000000000000000"},
+		{name: "unknown fields", json: `{"nonce":1,"balance":2,"code":"0x","storage_root":"0xabc"}`, nonce: 1, balance: "2",
+			extra: []string{"code", "storage_root"}},
+
+		{name: "missing nonce", json: `{"balance":1}`, err: "nonce"},
+		{name: "null nonce", json: `{"nonce":null,"balance":1}`, err: "nonce"},
+		{name: "fractional nonce", json: `{"nonce":1.5,"balance":1}`, err: "nonce"},
+		{name: "nonce above 2^64", json: `{"nonce":18446744073709551616,"balance":1}`, err: "nonce"},
+		{name: "bad hex nonce", json: `{"nonce":"0xzz","balance":1}`, err: "nonce"},
+		{name: "missing balance", json: `{"nonce":1}`, err: "balance"},
+		{name: "negative balance", json: `{"nonce":1,"balance":-1}`, err: "balance"},
+		{name: "negative string balance", json: `{"nonce":1,"balance":"-5"}`, err: "balance"},
+		{name: "boolean balance", json: `{"nonce":1,"balance":true}`, err: "balance"},
+		{name: "numeric address", json: `{"address":1,"nonce":1,"balance":1}`, err: "address"},
+		{name: "null result", json: `null`, err: "null"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var state AccountState
+			err := json.Unmarshal([]byte(tc.json), &state)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Unmarshal(%s) error = %v, want one naming %q", tc.json, err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tc.json, err)
+			}
+			if state.Nonce != tc.nonce {
+				t.Errorf("Nonce = %d, want %d", state.Nonce, tc.nonce)
+			}
+			if state.Balance == nil || state.Balance.String() != tc.balance {
+				t.Errorf("Balance = %v, want %s", state.Balance, tc.balance)
+			}
+			if len(state.Extra) != len(tc.extra) {
+				t.Errorf("Extra = %v, want %v", state.Extra, tc.extra)
+			}
+			for _, name := range tc.extra {
+				if _, ok := state.Extra[name]; !ok {
+					t.Errorf("Extra is missing %q", name)
+				}
+			}
+		})
+	}
+}
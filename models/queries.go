@@ -0,0 +1,88 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Balance is the result of xygle_getBalance. The node may answer with a bare
+// amount or with an object holding address and balance.
+type Balance struct {
+	Address string
+	Balance *big.Int
+}
+
+func (b *Balance) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		amount, err := decodeBigInt(data)
+		if err != nil {
+			return fmt.Errorf("balance: %w", err)
+		}
+		*b = Balance{Balance: amount}
+		return nil
+	}
+
+	var fields struct {
+		Address string          `json:"address"`
+		Balance json.RawMessage `json:"balance"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("balance: %w", err)
+	}
+	if fields.Balance == nil {
+		return fmt.Errorf("balance: missing balance")
+	}
+	amount, err := decodeBigInt(fields.Balance)
+	if err != nil {
+		return fmt.Errorf("balance: %w", err)
+	}
+	*b = Balance{Address: fields.Address, Balance: amount}
+	return nil
+}
+
+func (b Balance) MarshalJSON() ([]byte, error) {
+	amount := "0"
+	if b.Balance != nil {
+		amount = b.Balance.String()
+	}
+	return json.Marshal(map[string]interface{}{
+		"address": b.Address,
+		"balance": json.Number(amount),
+	})
+}
+
+// TransactionPage is one page of xygle_getTransactions, newest first.
+type TransactionPage struct {
+	Transactions []TransactionResult `json:"transactions"`
+	// NextCursor requests the following page; it is empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// AccountActivity is one entry of an account's history, as returned by
+// xygle_getAccountActivity.
+type AccountActivity struct {
+	TransactionID string `json:"transaction_id"`
+	// Direction is "sent" or "received".
+	Direction    string `json:"direction"`
+	Counterparty string `json:"counterparty"`
+	Value        int64  `json:"value"`
+	Nonce        uint64 `json:"nonce,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+// NodeStats is the result of xygle_getNodeStats.
+type NodeStats struct {
+	NodeID              string  `json:"node_id,omitempty"`
+	Version             string  `json:"version,omitempty"`
+	Peers               int     `json:"peers"`
+	Height              uint64  `json:"height"`
+	PendingTransactions int     `json:"pending_transactions"`
+	TotalTransactions   uint64  `json:"total_transactions"`
+	TPS                 float64 `json:"tps"`
+	UptimeSeconds       int64   `json:"uptime_seconds"`
+	Synced              bool    `json:"synced"`
+}
@@ -0,0 +1,205 @@
+package nonce
+
+import (
+	"context"
+	"fmt"
+	"metrics/logger"
+	"time"
+)
+
+// GapFiller submits a transaction that uses up nonce without other effect,
+// such as a zero-value transfer to the account itself, and returns its ID.
+type GapFiller func(ctx context.Context, nonce uint64) (string, error)
+
+// GapStats counts the gap events and recovery actions of an account.
+type GapStats struct {
+	// Detected counts nonces the chain stalled at because nothing was in
+	// flight for them.
+	Detected int
+	// Reused counts released nonces handed out again, Filled those filled
+	// with a GapFiller.
+	Reused int
+	Filled int
+	// Resynced counts the times the next nonce was moved forward to the
+	// chain's.
+	Resynced int
+}
+
+// Add adds the counts of other to s.
+func (s *GapStats) Add(other GapStats) {
+	s.Detected += other.Detected
+	s.Reused += other.Reused
+	s.Filled += other.Filled
+	s.Resynced += other.Resynced
+}
+
+// SetGapFiller makes CheckGaps fill gaps with filler once they have lasted
+// timeout; a zero timeout keeps the current one (3s by default). Without a
+// filler, gaps are only reported.
+func (nm *NonceManager) SetGapFiller(filler GapFiller, timeout time.Duration) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	nm.filler = filler
+	if timeout > 0 {
+		nm.gapTimeout = timeout
+	}
+}
+
+// LowestUnconfirmed returns the lowest nonce the chain had not executed at
+// the last sync.
+func (nm *NonceManager) LowestUnconfirmed() uint64 {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	return nm.confirmed
+}
+
+// GapStats returns the gap counts so far.
+func (nm *NonceManager) GapStats() GapStats {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	return nm.gapStats
+}
+
+// Resync reads the account's next nonce from the node. If the chain is
+// ahead, because another client sent from the account, the next nonce moves
+// up to it; released nonces the chain has used up are dropped either way.
+// It returns the chain's next nonce.
+func (nm *NonceManager) Resync(ctx context.Context) (uint64, error) {
+	next, err := nm.adapter.GetNonce(ctx, nm.node, nm.address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get account nonce: %v", err)
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	nm.confirmed = next
+	if next > nm.nextNonce {
+		logger.Metrics.Printf("Nonce of %s resynced from %d to %d", nm.address, nm.nextNonce, next)
+		nm.nextNonce = next
+		nm.gapStats.Resynced++
+	}
+	for len(nm.free) > 0 && nm.free[0] < next {
+		nm.free = nm.free[1:]
+	}
+	for nonce := range nm.gapSince {
+		if nonce < next {
+			delete(nm.gapSince, nonce)
+		}
+	}
+	return next, nil
+}
+
+// CheckGaps resyncs with the chain and looks for nonces it cannot get past:
+// allocated nonces with nothing in flight for them, because their
+// submission failed, below others that are in flight. Each gap is logged
+// when first seen and, if it lasts the gap timeout without being reused,
+// filled with the gap filler. A failed fill is tried again once the gap has
+// lasted another gap timeout.
+func (nm *NonceManager) CheckGaps(ctx context.Context) error {
+	chainNext, err := nm.Resync(ctx)
+	if err != nil {
+		return err
+	}
+
+	nm.mutex.Lock()
+	next := nm.nextNonce
+	nm.mutex.Unlock()
+	if chainNext >= next {
+		return nil
+	}
+
+	now := time.Now()
+	var due []uint64
+	nm.mutex.Lock()
+	// Only nonces below one still in flight hold anything up
+	top := chainNext
+	for nonce := chainNext; nonce < next; nonce++ {
+		if nm.inFlight(nonce) {
+			top = nonce
+		}
+	}
+	for nonce := chainNext; nonce < top; nonce++ {
+		if nm.inFlight(nonce) {
+			delete(nm.gapSince, nonce)
+			continue
+		}
+		since, seen := nm.gapSince[nonce]
+		if !seen {
+			nm.gapSince[nonce] = now
+			nm.gapStats.Detected++
+			logger.Metrics.Printf("Nonce gap at %d for %s: chain at %d, nonces up to %d waiting behind it",
+				nonce, nm.address, chainNext, top)
+			continue
+		}
+		if nm.filler != nil && now.Sub(since) >= nm.gapTimeout {
+			due = append(due, nonce)
+		}
+	}
+	filler := nm.filler
+	nm.mutex.Unlock()
+
+	for _, nonce := range due {
+		if !nm.claimGap(nonce) {
+			continue
+		}
+		txID, err := filler(ctx, nonce)
+		if err != nil {
+			logger.Error.Printf("failed to fill nonce gap %d of %s: %v", nonce, nm.address, err)
+			nm.MarkFailed(nonce)
+			// Wait out another gap timeout before the next attempt
+			nm.mutex.Lock()
+			nm.gapSince[nonce] = time.Now()
+			nm.mutex.Unlock()
+			continue
+		}
+		nm.MarkSubmitted(nonce, txID)
+
+		nm.mutex.Lock()
+		delete(nm.gapSince, nonce)
+		nm.gapStats.Filled++
+		nm.mutex.Unlock()
+		logger.Metrics.Printf("Filled nonce gap %d of %s with self-transfer %s", nonce, nm.address, txID)
+	}
+	return nil
+}
+
+// inFlight reports whether nonce is allocated and neither failed nor
+// released. nm.mutex must be held.
+func (nm *NonceManager) inFlight(nonce uint64) bool {
+	for _, free := range nm.free {
+		if free == nonce {
+			return false
+		}
+	}
+	nm.statesMutex.RLock()
+	state, ok := nm.nonceStates[nonce]
+	nm.statesMutex.RUnlock()
+	if !ok {
+		return false
+	}
+	state.Mutex.RLock()
+	defer state.Mutex.RUnlock()
+	return !state.Failed
+}
+
+// claimGap takes nonce off the free list and gives it a fresh state,
+// recorded as an allocation, unless it has been handed out again since it
+// was found to be a gap.
+func (nm *NonceManager) claimGap(nonce uint64) bool {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	if nm.inFlight(nonce) {
+		return false
+	}
+	for i, free := range nm.free {
+		if free == nonce {
+			nm.free = append(nm.free[:i], nm.free[i+1:]...)
+			break
+		}
+	}
+	nm.statesMutex.Lock()
+	nm.nonceStates[nonce] = &NonceState{Nonce: nonce}
+	nm.statesMutex.Unlock()
+	nm.record(OpAllocate, nonce, "")
+	return true
+}
@@ -0,0 +1,401 @@
+package nonce
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"metrics/logger"
+	"metrics/rpc"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Journal operations, one per NonceManager transition.
+const (
+	OpAllocate = "allocate"
+	OpSubmit   = "submit"
+	OpExecute  = "execute"
+	OpFail     = "fail"
+	OpRelease  = "release"
+)
+
+// JournalRecord is one nonce transition. A journal is a file of records,
+// one JSON object per line, in the order they happened.
+type JournalRecord struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account"`
+	Op      string    `json:"op"`
+	Nonce   uint64    `json:"nonce"`
+	TxID    string    `json:"tx_id,omitempty"`
+}
+
+// Journal is an append-only log of the nonce transitions of every account,
+// synced to disk before each Append returns, so a run that crashed can be
+// resumed without reusing or skipping nonces (see NonceManager.Recover).
+// Concurrent appends share their syncs. It is safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+	// last holds the last replayed record of each nonce, by account.
+	last map[string]map[uint64]JournalRecord
+	// floors holds the chain's next nonce of each account Recover has
+	// reconciled; Compact drops the records below it.
+	floors map[string]uint64
+
+	// Group commit: written counts the records written, durable those
+	// known to be on disk. One Append at a time syncs, for every record
+	// written until then, while the others wait on synced.
+	synced  *sync.Cond
+	written uint64
+	durable uint64
+	syncing bool
+	// err is the first failed sync. The records it covered may be lost, so
+	// every later Append fails with it.
+	err error
+}
+
+// OpenJournal opens the journal at path, creating it if needed, and replays
+// the records already in it. A record cut short by a crash is discarded.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nonce journal: %w", err)
+	}
+	j := &Journal{
+		file:   f,
+		path:   path,
+		last:   make(map[string]map[uint64]JournalRecord),
+		floors: make(map[string]uint64),
+	}
+	j.synced = sync.NewCond(&j.mu)
+
+	end, err := j.replay()
+	if err == nil {
+		// Drop a partial last line, so new records start on a line of their own
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read nonce journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// replay reads every complete record and returns the offset after the last.
+func (j *Journal) replay() (int64, error) {
+	return readRecords(j.file, func(rec JournalRecord) {
+		nonces := j.last[rec.Account]
+		if nonces == nil {
+			nonces = make(map[uint64]JournalRecord)
+			j.last[rec.Account] = nonces
+		}
+		nonces[rec.Nonce] = rec
+	})
+}
+
+// readRecords calls fn for every complete record in r and returns the
+// offset after the last.
+func readRecords(r io.Reader, fn func(JournalRecord)) (int64, error) {
+	br := bufio.NewReader(r)
+	var end int64
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		end += int64(len(data))
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return 0, fmt.Errorf("record %d: %v", line, err)
+		}
+		fn(rec)
+	}
+}
+
+// Path returns the file the journal is written to.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append writes rec and returns once it is synced to disk. A zero Time is
+// set to now. Records appended while a sync is under way are synced
+// together by the next one, so concurrent appends do not queue up behind
+// one sync each.
+func (j *Journal) Append(rec JournalRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write nonce journal: %w", err)
+	}
+	j.written++
+	seq := j.written
+
+	for j.durable < seq {
+		if j.err != nil {
+			return j.err
+		}
+		if j.syncing {
+			j.synced.Wait()
+			continue
+		}
+		j.syncing = true
+		target := j.written
+		j.mu.Unlock()
+		err := j.file.Sync()
+		j.mu.Lock()
+		j.syncing = false
+		if err != nil {
+			j.err = fmt.Errorf("failed to sync nonce journal: %w", err)
+		} else {
+			j.durable = target
+		}
+		j.synced.Broadcast()
+	}
+	return nil
+}
+
+// settle records that the chain has executed every nonce of account below
+// next, so Compact can drop their records.
+func (j *Journal) settle(account string, next uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.floors[account] = next
+}
+
+// Compact rewrites the journal with only the last record of each nonce,
+// leaving out the nonces below the chain's next nonce of every account that
+// has been recovered. The new file replaces the old one atomically, so a
+// crash during Compact leaves one or the other.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for j.syncing {
+		j.synced.Wait()
+	}
+	if j.err != nil {
+		return j.err
+	}
+
+	type key struct {
+		account string
+		nonce   uint64
+	}
+	var order []key
+	last := make(map[key]JournalRecord)
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to compact nonce journal: %w", err)
+	}
+	_, err := readRecords(j.file, func(rec JournalRecord) {
+		k := key{rec.Account, rec.Nonce}
+		if floor, ok := j.floors[rec.Account]; ok && rec.Nonce < floor {
+			return
+		}
+		if _, seen := last[k]; !seen {
+			order = append(order, k)
+		}
+		last[k] = rec
+	})
+	if err == nil {
+		_, err = j.file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact nonce journal: %w", err)
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to compact nonce journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, k := range order {
+		line, err := json.Marshal(last[k])
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, j.path)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(j.path))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact nonce journal: %w", err)
+	}
+	j.file.Close()
+	j.file = f
+	logger.Metrics.Printf("Compacted nonce journal %s to %d records", j.path, len(order))
+	return nil
+}
+
+// syncDir syncs a directory, so that a rename in it is on disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Replayed returns the last record of each nonce of account found when the
+// journal was opened.
+func (j *Journal) Replayed(account string) map[uint64]JournalRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := make(map[uint64]JournalRecord, len(j.last[account]))
+	for nonce, rec := range j.last[account] {
+		result[nonce] = rec
+	}
+	return result
+}
+
+// Close syncs and closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for j.syncing {
+		j.synced.Wait()
+	}
+	if err := j.file.Sync(); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
+
+// record appends a transition to the journal, if any. A record that cannot
+// be written is logged rather than failing the transition.
+func (nm *NonceManager) record(op string, nonce uint64, txID string) {
+	if nm.journal == nil {
+		return
+	}
+	if err := nm.journal.Append(JournalRecord{Account: nm.address, Op: op, Nonce: nonce, TxID: txID}); err != nil {
+		logger.Error.Printf("nonce %d of %s: %v", nonce, nm.address, err)
+	}
+}
+
+// Recover reconciles what journal recorded for the account in earlier runs
+// with the chain, then records every further transition in it. It must be
+// called before the first nonce is allocated.
+//
+// Nonces the chain has executed are done. Above them, submissions the node
+// still knows are tracked again as pending, released nonces are free for
+// reuse, and nonces whose submission may have reached the chain are left
+// failed, for CheckGaps to fill if the chain stalls at them. The next nonce
+// continues after the highest one recorded.
+func (nm *NonceManager) Recover(ctx context.Context, journal *Journal) error {
+	chainNext, err := nm.adapter.GetNonce(ctx, nm.node, nm.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account nonce: %v", err)
+	}
+
+	records := journal.Replayed(nm.address)
+	journal.settle(nm.address, chainNext)
+	var txIDs []string
+	for nonce, rec := range records {
+		if nonce >= chainNext && rec.Op == OpSubmit && rec.TxID != "" {
+			txIDs = append(txIDs, rec.TxID)
+		}
+	}
+	var statuses map[string]rpc.StatusResult
+	if len(txIDs) > 0 {
+		statuses = nm.adapter.GetStatuses(ctx, nm.node, txIDs)
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	nm.journal = journal
+	nm.confirmed = chainNext
+	if chainNext > nm.nextNonce {
+		nm.nextNonce = chainNext
+	}
+
+	var pending, released, failed int
+	var lost []uint64
+	nm.statesMutex.Lock()
+	for nonce, rec := range records {
+		if nonce < chainNext {
+			continue
+		}
+		if nonce >= nm.nextNonce {
+			nm.nextNonce = nonce + 1
+		}
+		switch rec.Op {
+		case OpExecute:
+		case OpRelease:
+			nm.free = append(nm.free, nonce)
+			released++
+		case OpSubmit:
+			state := &NonceState{Nonce: nonce, TxID: rec.TxID, Submitted: true, SubmittedAt: rec.Time}
+			res, ok := statuses[rec.TxID]
+			switch {
+			case ok && res.Err == nil && res.Status.Status.Executed():
+				state.Executed = true
+				state.ExecutedAt = time.Now()
+			case ok && (errors.Is(res.Err, rpc.ErrNotFound) || res.Err == nil && res.Status.Status == rpc.StatusUnknown):
+				// Dropped by the node; the chain will stall here
+				state.Failed = true
+				lost = append(lost, nonce)
+			default:
+				pending++
+			}
+			nm.nonceStates[nonce] = state
+		default:
+			// Allocated or failed: the submission may still land
+			nm.nonceStates[nonce] = &NonceState{Nonce: nonce, TxID: rec.TxID, Failed: true}
+			failed++
+		}
+	}
+	nm.statesMutex.Unlock()
+	slices.Sort(nm.free)
+	nm.trimFree()
+
+	for _, nonce := range lost {
+		nm.record(OpFail, nonce, "")
+	}
+	failed += len(lost)
+	logger.Metrics.Printf("Recovered nonces of %s from %s: chain at %d, next %d; %d pending, %d released, %d failed",
+		nm.address, journal.Path(), chainNext, nm.nextNonce, pending, released, failed)
+	return nil
+}
@@ -0,0 +1,138 @@
+package nonce
+
+import (
+	"context"
+	"fmt"
+	"metrics/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// journalOps reads the ops recorded at path for nonce of account, in order.
+func journalOps(t *testing.T, path, account string, nonce uint64) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ops []string
+	if _, err := readRecords(f, func(rec JournalRecord) {
+		if rec.Account == account && rec.Nonce == nonce {
+			ops = append(ops, rec.Op)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+func TestJournalConcurrentAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(account string) {
+			defer wg.Done()
+			for nonce := uint64(1); nonce <= 50; nonce++ {
+				if err := journal.Append(JournalRecord{Account: account, Op: OpAllocate, Nonce: nonce}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("0x%d", i))
+	}
+	wg.Wait()
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for i := 0; i < 8; i++ {
+		if got := len(reopened.Replayed(fmt.Sprintf("0x%d", i))); got != 50 {
+			t.Errorf("account %d: %d nonces replayed, want 50", i, got)
+		}
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		for _, op := range []string{OpAllocate, OpSubmit, OpExecute} {
+			for _, account := range []string{"0xa", "0xb"} {
+				journal.Append(JournalRecord{Account: account, Op: op, Nonce: nonce})
+			}
+		}
+	}
+	// The chain has executed 0xa up to nonce 2; 0xb was not reconciled
+	journal.settle("0xa", 3)
+	if err := journal.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	// Appends go to the compacted file
+	if err := journal.Append(JournalRecord{Account: "0xa", Op: OpAllocate, Nonce: 5}); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	for nonce, want := range map[uint64]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 1} {
+		if got := len(journalOps(t, path, "0xa", nonce)); got != want {
+			t.Errorf("0xa nonce %d: %d records, want %d", nonce, got, want)
+		}
+	}
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		if ops := journalOps(t, path, "0xb", nonce); len(ops) != 1 || ops[0] != OpExecute {
+			t.Errorf("0xb nonce %d: records %v, want only the last", nonce, ops)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+// A nonce taken back to fill a gap is recorded as allocated again, so a
+// crash before the fill is submitted does not leave it marked failed only.
+func TestClaimGapRecordsAllocation(t *testing.T) {
+	srv, adapter, nm := newTestManager(t)
+	node := srv.Node()
+	path := filepath.Join(t.TempDir(), "nonces.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if err := nm.Recover(context.Background(), journal); err != nil {
+		t.Fatal(err)
+	}
+	nm.SetGapFiller(func(ctx context.Context, nonce uint64) (string, error) {
+		return adapter.SubmitTransfer(ctx, node, rpc.Transfer{Sender: node.Address, Receiver: node.Address, Nonce: nonce})
+	}, 10*time.Millisecond)
+
+	nm.AllocateNonce()
+	nm.AllocateNonce()
+	nm.MarkFailed(1)
+	send(t, adapter, node, nm, 2)
+	nm.CheckGaps(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	nm.CheckGaps(context.Background())
+
+	want := []string{OpAllocate, OpFail, OpAllocate, OpSubmit}
+	if got := journalOps(t, path, node.Address, 1); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records of the filled nonce = %v, want %v", got, want)
+	}
+}
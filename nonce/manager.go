@@ -1,66 +1,107 @@
 package nonce
 
 import (
+	"context"
 	"fmt"
 	"metrics/logger"
 	"metrics/models"
 	"metrics/rpc"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
 
 type NonceManager struct {
-	node         model.NodeInfo
-	currentNonce int
-	mutex        sync.Mutex
-	nonceStates map[int]*NonceState
+	adapter     rpc.ChainAdapter
+	node        model.NodeInfo
+	address     string
+	nextNonce   uint64
+	mutex       sync.Mutex
+	nonceStates map[uint64]*NonceState
 	statesMutex sync.RWMutex
+	// free holds released nonces, lowest first, for AllocateNonce to hand
+	// out again. confirmed is the lowest nonce the chain had not executed
+	// at the last sync. Both are guarded by mutex, as are the gap fields.
+	free       []uint64
+	confirmed  uint64
+	filler     GapFiller
+	gapTimeout time.Duration
+	gapSince   map[uint64]time.Time
+	gapStats   GapStats
+	// journal, if set, records every transition (see Recover).
+	journal *Journal
 }
 
 type NonceState struct {
-	Nonce       int
+	Nonce       uint64
 	TxID        string
 	Submitted   bool
 	Executed    bool
 	Failed      bool
 	SubmittedAt time.Time
 	ExecutedAt  time.Time
-	Mutex       sync.RWMutex 
+	Mutex       sync.RWMutex
 }
 
-func NewNonceManager(node model.NodeInfo) (*NonceManager, error) {
-	state, err := rpc.GetAccountState(node, node.Address)
+// NewNonceManager hands out nonces for address, starting with the next nonce
+// node reports for it.
+func NewNonceManager(ctx context.Context, adapter rpc.ChainAdapter, node model.NodeInfo, address string) (*NonceManager, error) {
+	next, err := adapter.GetNonce(ctx, node, address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account state: %v", err)
+		return nil, fmt.Errorf("failed to get account nonce: %v", err)
 	}
 
-	currentNonce := int(state["nonce"].(float64))
-
 	return &NonceManager{
-		node:         node,
-		currentNonce: currentNonce,
-		nonceStates:  make(map[int]*NonceState),
+		adapter:     adapter,
+		node:        node,
+		address:     address,
+		nextNonce:   next,
+		nonceStates: make(map[uint64]*NonceState),
+		confirmed:   next,
+		gapTimeout:  3 * time.Second,
+		gapSince:    make(map[uint64]time.Time),
 	}, nil
 }
 
-func (nm *NonceManager) AllocateNonce() int {
+// Node returns the node the manager reads account state from.
+func (nm *NonceManager) Node() model.NodeInfo {
+	return nm.node
+}
+
+func (nm *NonceManager) Address() string {
+	return nm.address
+}
+
+// AllocateNonce hands out the lowest released nonce, if any, and otherwise
+// the next unused one.
+func (nm *NonceManager) AllocateNonce() uint64 {
 	nm.mutex.Lock()
 	defer nm.mutex.Unlock()
 
-	nm.currentNonce++
-	nonce := nm.currentNonce
+	var nonce uint64
+	if len(nm.free) > 0 {
+		nonce = nm.free[0]
+		nm.free = nm.free[1:]
+		nm.gapStats.Reused++
+		logger.Metrics.Printf("Reusing released nonce %d of %s", nonce, nm.address)
+	} else {
+		nonce = nm.nextNonce
+		nm.nextNonce++
+	}
 
 	nm.statesMutex.Lock()
 	nm.nonceStates[nonce] = &NonceState{
 		Nonce: nonce,
 	}
 	nm.statesMutex.Unlock()
+	nm.record(OpAllocate, nonce, "")
 
 	logger.Metrics.Printf("Allocated nonce %d", nonce)
 	return nonce
 }
 
-func (nm *NonceManager) MarkSubmitted(nonce int, txID string) {
+func (nm *NonceManager) MarkSubmitted(nonce uint64, txID string) {
 	nm.statesMutex.RLock()
 	state, exists := nm.nonceStates[nonce]
 	nm.statesMutex.RUnlock()
@@ -75,9 +116,10 @@ func (nm *NonceManager) MarkSubmitted(nonce int, txID string) {
 	state.Submitted = true
 	state.SubmittedAt = time.Now()
 	state.Mutex.Unlock()
+	nm.record(OpSubmit, nonce, txID)
 }
 
-func (nm *NonceManager) MarkExecuted(nonce int) {
+func (nm *NonceManager) MarkExecuted(nonce uint64) {
 	nm.statesMutex.RLock()
 	state, exists := nm.nonceStates[nonce]
 	nm.statesMutex.RUnlock()
@@ -91,11 +133,15 @@ func (nm *NonceManager) MarkExecuted(nonce int) {
 	state.Executed = true
 	state.ExecutedAt = time.Now()
 	state.Mutex.Unlock()
+	nm.record(OpExecute, nonce, "")
 
 	// logger.Metrics.Printf("Marked nonce %d as executed", nonce)
 }
 
-func (nm *NonceManager) MarkFailed(nonce int) {
+// MarkFailed flags nonce as failed without making it available again, for
+// submissions that may still have reached the chain. If the chain stalls
+// at it, CheckGaps fills it.
+func (nm *NonceManager) MarkFailed(nonce uint64) {
 	nm.statesMutex.RLock()
 	state, exists := nm.nonceStates[nonce]
 	nm.statesMutex.RUnlock()
@@ -108,18 +154,62 @@ func (nm *NonceManager) MarkFailed(nonce int) {
 	state.Mutex.Lock()
 	state.Failed = true
 	state.Mutex.Unlock()
+	nm.record(OpFail, nonce, "")
 
 	logger.Metrics.Printf("Marked nonce %d as failed", nonce)
 }
 
-func (nm *NonceManager) GetAllStates() map[int]*NonceState {
+// Release marks nonce as failed and returns it to the free list, for
+// submissions that certainly did not reach the chain. Released nonces at
+// the top of the sequence lower the next nonce instead.
+func (nm *NonceManager) Release(nonce uint64) {
+	nm.MarkFailed(nonce)
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	if nonce < nm.confirmed || nonce >= nm.nextNonce {
+		return
+	}
+	i := sort.Search(len(nm.free), func(i int) bool { return nm.free[i] >= nonce })
+	if i < len(nm.free) && nm.free[i] == nonce {
+		return
+	}
+	nm.free = slices.Insert(nm.free, i, nonce)
+	nm.record(OpRelease, nonce, "")
+	logger.Metrics.Printf("Released nonce %d of %s for reuse", nonce, nm.address)
+	nm.trimFree()
+}
+
+// trimFree lowers the next nonce past released nonces at the top of the
+// sequence. nm.mutex must be held.
+func (nm *NonceManager) trimFree() {
+	for n := len(nm.free); n > 0 && nm.free[n-1] == nm.nextNonce-1; n-- {
+		nm.nextNonce--
+		nm.free = nm.free[:n-1]
+	}
+}
+
+func (nm *NonceManager) GetAllStates() map[uint64]*NonceState {
 	nm.statesMutex.RLock()
 	defer nm.statesMutex.RUnlock()
-	result := make(map[int]*NonceState)
+	result := make(map[uint64]*NonceState)
 	for k, v := range nm.nonceStates {
 		result[k] = v
 	}
 	return result
 }
 
-
+// Prune forgets the states of executed and failed nonces, which nothing
+// waits on any more, so long runs do not accumulate them.
+func (nm *NonceManager) Prune() {
+	nm.statesMutex.Lock()
+	defer nm.statesMutex.Unlock()
+	for nonce, state := range nm.nonceStates {
+		state.Mutex.RLock()
+		done := state.Executed || state.Failed
+		state.Mutex.RUnlock()
+		if done {
+			delete(nm.nonceStates, nonce)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package nonce
+
+import (
+	"context"
+	"errors"
+	"metrics/logger"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitDiscard()
+	os.Exit(m.Run())
+}
+
+// newTestManager starts a mock node and a manager for the account it signs
+// for.
+func newTestManager(t *testing.T) (*rpctest.Server, rpc.ChainAdapter, *NonceManager) {
+	t.Helper()
+	srv := rpctest.NewServer(rpctest.Config{
+		ExecutionDelay: rpctest.Fixed(20 * time.Millisecond),
+		FinalityDelay:  rpctest.Fixed(20 * time.Millisecond),
+	})
+	t.Cleanup(srv.Close)
+	client := rpc.NewClient(rpc.ClientConfig{})
+	t.Cleanup(client.CloseIdleConnections)
+	adapter := rpc.NewXygleAdapter(client)
+
+	nm, err := NewNonceManager(context.Background(), adapter, srv.Node(), srv.Node().Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, adapter, nm
+}
+
+// send submits a transfer with nonce and records it with nm.
+func send(t *testing.T, adapter rpc.ChainAdapter, node model.NodeInfo, nm *NonceManager, nonce uint64) {
+	t.Helper()
+	txID, err := adapter.SubmitTransfer(context.Background(), node, rpc.Transfer{
+		Sender:   node.Address,
+		Receiver: "0xreceiver",
+		Value:    1,
+		Nonce:    nonce,
+	})
+	if err != nil {
+		t.Fatalf("submit nonce %d: %v", nonce, err)
+	}
+	nm.MarkSubmitted(nonce, txID)
+}
+
+// waitForNonce waits until the node has executed nonce for the account.
+func waitForNonce(t *testing.T, srv *rpctest.Server, nonce uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Nonce(srv.Node().Address) < nonce {
+		if time.Now().After(deadline) {
+			t.Fatalf("account nonce is %d after 5s, want %d", srv.Nonce(srv.Node().Address), nonce)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReleaseReusesNonce(t *testing.T) {
+	_, _, nm := newTestManager(t)
+
+	for want := uint64(1); want <= 3; want++ {
+		if got := nm.AllocateNonce(); got != want {
+			t.Fatalf("AllocateNonce() = %d, want %d", got, want)
+		}
+	}
+	nm.Release(2)
+	if got := nm.AllocateNonce(); got != 2 {
+		t.Errorf("after releasing 2, AllocateNonce() = %d, want 2", got)
+	}
+	// The top nonce lowers the next one instead of joining the free list
+	nm.Release(3)
+	if got := nm.AllocateNonce(); got != 3 {
+		t.Errorf("after releasing 3, AllocateNonce() = %d, want 3", got)
+	}
+	if got := nm.AllocateNonce(); got != 4 {
+		t.Errorf("AllocateNonce() = %d, want 4", got)
+	}
+	if stats := nm.GapStats(); stats.Reused != 1 {
+		t.Errorf("Reused = %d, want 1", stats.Reused)
+	}
+}
+
+func TestMarkFailedKeepsNonce(t *testing.T) {
+	_, _, nm := newTestManager(t)
+
+	nm.AllocateNonce()
+	nm.AllocateNonce()
+	// The submission may have reached the chain, so 1 is not handed out again
+	nm.MarkFailed(1)
+	if got := nm.AllocateNonce(); got != 3 {
+		t.Errorf("AllocateNonce() = %d, want 3", got)
+	}
+}
+
+func TestCheckGapsFillsGap(t *testing.T) {
+	srv, adapter, nm := newTestManager(t)
+	node := srv.Node()
+	nm.SetGapFiller(func(ctx context.Context, nonce uint64) (string, error) {
+		return adapter.SubmitTransfer(ctx, node, rpc.Transfer{Sender: node.Address, Receiver: node.Address, Nonce: nonce})
+	}, 50*time.Millisecond)
+
+	// Nonce 1 fails without being released; 2 and 3 wait behind it
+	for i := 0; i < 3; i++ {
+		nm.AllocateNonce()
+	}
+	nm.MarkFailed(1)
+	send(t, adapter, node, nm, 2)
+	send(t, adapter, node, nm, 3)
+
+	ctx := context.Background()
+	if err := nm.CheckGaps(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := nm.GapStats(); stats.Detected != 1 || stats.Filled != 0 {
+		t.Fatalf("after the first check, GapStats() = %+v, want 1 detected and none filled", stats)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := nm.CheckGaps(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := nm.GapStats(); stats.Filled != 1 {
+		t.Fatalf("after the timeout, GapStats() = %+v, want 1 filled", stats)
+	}
+
+	waitForNonce(t, srv, 3)
+	if got := srv.Balance("0xreceiver"); got != 2 {
+		t.Errorf("receiver balance = %d, want 2", got)
+	}
+}
+
+// A fill that fails waits out another gap timeout rather than being retried
+// on every check.
+func TestCheckGapsWaitsAfterFailedFill(t *testing.T) {
+	srv, adapter, nm := newTestManager(t)
+	node := srv.Node()
+	fills := 0
+	nm.SetGapFiller(func(ctx context.Context, nonce uint64) (string, error) {
+		fills++
+		return "", errors.New("node unavailable")
+	}, 50*time.Millisecond)
+
+	nm.AllocateNonce()
+	nm.AllocateNonce()
+	nm.MarkFailed(1)
+	send(t, adapter, node, nm, 2)
+
+	ctx := context.Background()
+	check := func() {
+		t.Helper()
+		if err := nm.CheckGaps(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+	time.Sleep(60 * time.Millisecond)
+	check()
+	if fills != 1 {
+		t.Fatalf("after the timeout, %d fills, want 1", fills)
+	}
+	check()
+	if fills != 1 {
+		t.Errorf("right after a failed fill, %d fills, want 1", fills)
+	}
+	time.Sleep(60 * time.Millisecond)
+	check()
+	if fills != 2 {
+		t.Errorf("after another timeout, %d fills, want 2", fills)
+	}
+}
+
+func TestResyncSkipsNoncesUsedElsewhere(t *testing.T) {
+	srv, adapter, nm := newTestManager(t)
+	node := srv.Node()
+
+	// Another client sends from the account
+	if _, err := adapter.SubmitTransfer(context.Background(), node, rpc.Transfer{Sender: node.Address, Receiver: "0xother", Value: 1, Nonce: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitForNonce(t, srv, 1)
+
+	next, err := nm.Resync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 2 {
+		t.Errorf("Resync() = %d, want 2", next)
+	}
+	if got := nm.AllocateNonce(); got != 2 {
+		t.Errorf("AllocateNonce() = %d, want 2", got)
+	}
+	if stats := nm.GapStats(); stats.Resynced != 1 {
+		t.Errorf("Resynced = %d, want 1", stats.Resynced)
+	}
+}
@@ -1,193 +1,718 @@
 package parallel
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"metrics/logger"
 	"metrics/metricstracker"
 	"metrics/models"
 	"metrics/nonce"
 	"metrics/rpc"
-	"strings"
+	"metrics/schedule"
+	"metrics/signer"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type TransactionRequest struct {
 	ID       int
 	Receiver string
-	Value    int
+	Value    uint64
 }
 
 type TransactionResult struct {
-	ID      int
-	Nonce   int
-	TxID    string
+	ID    int
+	Nonce uint64
+	TxID  string
+	// Value is the amount the request transfers.
+	Value uint64
+	// Sender is the account the transaction was sent from.
+	Sender string
+	// Node is the URL of the node that accepted the transaction, or the
+	// last one tried if it failed.
+	Node    string
 	Success bool
 	Error   error
+	// Latency is the submission time, from the first attempt until the node
+	// accepted the transaction or the last attempt failed.
 	Latency time.Duration
+	// SentAt is when the first attempt was sent.
+	SentAt time.Time
+	// ScheduledAt is when an open-loop schedule meant the transaction to be
+	// sent; zero in closed-loop runs. SentAt minus ScheduledAt is the
+	// schedule lag.
+	ScheduledAt time.Time
+	// SignLatency is the time spent signing locally, zero when the node
+	// signs.
+	SignLatency time.Duration
+	// Phase is the load profile phase the transaction was sent in, empty
+	// outside profile runs.
+	Phase string
+	// Retries is the number of attempts after the first.
+	Retries int
+	// Ambiguous is set when an attempt timed out or lost its connection, so
+	// that it was unknown whether the node accepted the transaction.
+	// Landed is set when the transaction was then found on the node, which
+	// makes the submission successful.
+	Ambiguous bool
+	Landed    bool
+}
+
+// RunStats totals the submissions of a run without keeping their results.
+type RunStats struct {
+	Submitted  int
+	Successful int
+	Failed     int
+	// AcceptedValue totals the values of accepted transactions.
+	AcceptedValue uint64
+	// Retries totals the retried attempts of all submissions.
+	Retries int
+	// Ambiguous counts submissions with an ambiguous attempt, and Landed
+	// those of them found on a node.
+	Ambiguous int
+	Landed    int
+	// PerNode counts accepted transactions by node URL.
+	PerNode map[string]int
+	// SignLatency is the total time spent signing locally.
+	SignLatency time.Duration
+	// Scheduled counts open-loop submissions; ScheduleLag totals how far
+	// they trailed their intended start and MaxScheduleLag is the worst.
+	Scheduled      int
+	ScheduleLag    time.Duration
+	MaxScheduleLag time.Duration
+}
+
+// Add counts result.
+func (rs *RunStats) Add(result TransactionResult) {
+	rs.Submitted++
+	rs.SignLatency += result.SignLatency
+	rs.Retries += result.Retries
+	if result.Ambiguous {
+		rs.Ambiguous++
+	}
+	if result.Landed {
+		rs.Landed++
+	}
+	if result.Success {
+		rs.Successful++
+		rs.AcceptedValue += result.Value
+		if rs.PerNode == nil {
+			rs.PerNode = make(map[string]int)
+		}
+		rs.PerNode[result.Node]++
+	} else {
+		rs.Failed++
+	}
+	if !result.ScheduledAt.IsZero() && !result.SentAt.IsZero() {
+		lag := result.SentAt.Sub(result.ScheduledAt)
+		rs.Scheduled++
+		rs.ScheduleLag += lag
+		if lag > rs.MaxScheduleLag {
+			rs.MaxScheduleLag = lag
+		}
+	}
 }
 
 type ParallelExecutor struct {
-	node         model.NodeInfo
-	nonceManager *nonce.NonceManager
-	tracker      *metricstracker.Tracker
-	maxRetries   int
-	baseBackoff  time.Duration
-	nonceTimeout time.Duration
-	workers      int
+	adapter rpc.ChainAdapter
+	pool    *rpc.NodePool
+	// nonceManagers is keyed by sender address; nodes sharing an address
+	// share a nonce sequence.
+	nonceManagers map[string]*nonce.NonceManager
+	tracker       *metricstracker.Tracker
+	retry         rpc.RetryPolicy
+	pollInterval  time.Duration
+	nonceTimeout  time.Duration
+	// nodeWait bounds how long a submission waits for a node while every
+	// circuit is open.
+	nodeWait time.Duration
+	workers  int
+	// signers, when set, sign transfers locally; requests are spread over
+	// them round-robin.
+	signers    []*signer.Key
+	nextSigner atomic.Uint64
+	// journal, when set, records the nonce transitions of every account.
+	journal *nonce.Journal
 }
 
-func NewParallelExecutor(node model.NodeInfo, workers int) (*ParallelExecutor, error) {
-	nonceManager, err := nonce.NewNonceManager(node)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create nonce manager: %v", err)
+// NewParallelExecutor builds an executor that submits through pool. Its nonce
+// managers and tracker share adapter, so cancelling the context of a run
+// stops all of their calls.
+func NewParallelExecutor(ctx context.Context, adapter rpc.ChainAdapter, pool *rpc.NodePool, workers int) (*ParallelExecutor, error) {
+	nonceManagers := make(map[string]*nonce.NonceManager)
+	for _, node := range pool.Nodes() {
+		if _, ok := nonceManagers[node.Address]; ok {
+			continue
+		}
+		nonceManager, err := nonce.NewNonceManager(ctx, adapter, node, node.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create nonce manager for %s: %v", node.Address, err)
+		}
+		nonceManager.SetGapFiller(selfTransfer(adapter, node, node.Address, nil), 0)
+		nonceManagers[node.Address] = nonceManager
 	}
 
-	tracker := metricstracker.NewTracker(node)
+	tracker := metricstracker.NewTracker(adapter, pool.Nodes())
 
 	return &ParallelExecutor{
-		node:         node,
-		nonceManager: nonceManager,
-		tracker:      tracker,
-		maxRetries:   5,
-		baseBackoff:  100 * time.Millisecond,
-		nonceTimeout: 30 * time.Second,
-		workers:      workers,
+		adapter:       adapter,
+		pool:          pool,
+		nonceManagers: nonceManagers,
+		tracker:       tracker,
+		retry:         rpc.DefaultRetryPolicy(),
+		pollInterval:  100 * time.Millisecond,
+		nonceTimeout:  30 * time.Second,
+		nodeWait:      30 * time.Second,
+		workers:       workers,
 	}, nil
 }
 
-func (pe *ParallelExecutor) ExecuteTransactions(requests []TransactionRequest) ([]TransactionResult, error) {
+// ExecuteTransactions submits requests using at most pe.workers concurrent
+// submissions. Requests that have not started when ctx is cancelled are
+// skipped and in-flight calls are aborted.
+func (pe *ParallelExecutor) ExecuteTransactions(ctx context.Context, requests []TransactionRequest) ([]TransactionResult, error) {
+	var results []TransactionResult
+	err := pe.StreamTransactions(ctx, requests, collect(&results))
+	return results, err
+}
+
+// StreamTransactions is ExecuteTransactions passing each result to handle
+// as soon as its submission completes, instead of returning them all.
+func (pe *ParallelExecutor) StreamTransactions(ctx context.Context, requests []TransactionRequest, handle ResultHandler) error {
 	if len(requests) == 0 {
-		return nil, fmt.Errorf("no transaction requests provided")
+		return fmt.Errorf("no transaction requests provided")
 	}
 
-	var results []TransactionResult
 	var wg sync.WaitGroup
-	resultMutex := sync.Mutex{}
+	emit := pe.emitter(handle)
 
 	semaphore := make(chan struct{}, pe.workers)
 
 	for i, req := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+
 		wg.Add(1)
 		go func(index int, request TransactionRequest) {
 			defer wg.Done()
 
-			semaphore <- struct{}{}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-semaphore }()
 
-			result := pe.executeTransactionSequential(index, request)
-
-			resultMutex.Lock()
-			results = append(results, result)
-			if result.Success {
-				pe.tracker.MarkSubmitted(result.TxID, time.Now().Add(-result.Latency))
-			}
-			resultMutex.Unlock()
+			emit(pe.executeTransactionSequential(ctx, index, request))
 		}(i, req)
 
-		time.Sleep(10 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
 	}
 
 	wg.Wait()
 
-	// logger.Metrics.Printf("Completed transaction submission phase: %d successful, %d failed",
-	// 	pe.countSuccessful(results), len(results)-pe.countSuccessful(results))
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("transaction submission interrupted: %v", err)
+	}
+	return nil
+}
 
-	return results, nil
+// ExecuteOpenLoop submits requests at the times sched gives, whether or not
+// earlier submissions have returned, so the worker limit does not apply.
+// Each result records its intended start in ScheduledAt, and the tracker
+// measures corrected latency from it. Requests not yet due when ctx is
+// cancelled are skipped.
+func (pe *ParallelExecutor) ExecuteOpenLoop(ctx context.Context, requests []TransactionRequest, sched schedule.Scheduler) ([]TransactionResult, error) {
+	var results []TransactionResult
+	err := pe.StreamOpenLoop(ctx, requests, sched, collect(&results))
+	return results, err
 }
 
-func (pe *ParallelExecutor) executeTransactionSequential(_ int, req TransactionRequest) TransactionResult {
-	startTime := time.Now()
+// StreamOpenLoop is ExecuteOpenLoop passing each result to handle as soon
+// as its submission completes.
+func (pe *ParallelExecutor) StreamOpenLoop(ctx context.Context, requests []TransactionRequest, sched schedule.Scheduler, handle ResultHandler) error {
+	if len(requests) == 0 {
+		return fmt.Errorf("no transaction requests provided")
+	}
 
-	nonce := pe.nonceManager.AllocateNonce()
+	emit := pe.emitter(handle)
+	schedule.Dispatch(ctx, sched, len(requests), func(i int, intended time.Time) {
+		result := pe.executeTransactionSequential(ctx, i, requests[i])
+		result.ScheduledAt = intended
+		emit(result)
+	})
 
-	logger.Metrics.Printf("Processing transaction %d with nonce %d", req.ID, nonce)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("transaction submission interrupted: %v", err)
+	}
+	return nil
+}
 
-	for attempt := 1; attempt <= pe.maxRetries; attempt++ {
-		txID, err := rpc.TransferFund(pe.node, req.Receiver, req.Value, nonce)
-		if err != nil {
-			if attempt < pe.maxRetries && pe.shouldRetry(err) {
-				backoff := time.Duration(attempt) * pe.baseBackoff
-				logger.Metrics.Printf("Transaction %d (nonce=%d) attempt %d failed, retrying in %v: %v",
-					req.ID, nonce, attempt, backoff, err)
-				time.Sleep(backoff)
-				continue
-			}
+// ExecuteProfile runs the phases of profile in order, sending the next
+// request from src for every arrival. Open-loop phases space their
+// arrivals as arrivals does at rate 1 (see schedule.Profile.Run) and record
+// ScheduledAt; closed-loop phases keep their own number of workers busy.
+// Every result and tracked submission is tagged with its phase name. If src
+// runs out, the profile ends early.
+func (pe *ParallelExecutor) ExecuteProfile(ctx context.Context, profile schedule.Profile, arrivals func() schedule.Scheduler,
+	src RequestSource) ([]TransactionResult, error) {
+	var results []TransactionResult
+	err := pe.StreamProfile(ctx, profile, arrivals, src, collect(&results))
+	return results, err
+}
+
+// StreamProfile is ExecuteProfile passing each result to handle as soon as
+// its submission completes.
+func (pe *ParallelExecutor) StreamProfile(ctx context.Context, profile schedule.Profile, arrivals func() schedule.Scheduler,
+	src RequestSource, handle ResultHandler) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	emit := pe.emitter(handle)
+	next := serialize(src)
+	profile.Run(ctx, arrivals, func(a schedule.Arrival) bool {
+		req, ok := next()
+		if !ok {
+			return false
+		}
 
-			pe.nonceManager.MarkFailed(nonce)
-			return TransactionResult{
-				ID:      req.ID,
-				Nonce:   nonce,
-				Success: false,
-				Error:   fmt.Errorf("transaction failed after %d attempts: %v", attempt, err),
-				Latency: time.Since(startTime),
+		result := pe.executeTransactionSequential(ctx, a.Seq, req)
+		result.ScheduledAt = a.Intended
+		result.Phase = profile[a.Phase].Name
+		emit(result)
+		return true
+	})
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("transaction submission interrupted: %v", err)
+	}
+	return nil
+}
+
+// ExecuteFor submits requests from src for d, or until src runs out or ctx
+// is cancelled, and then waits for the submissions in flight. A zero d
+// leaves only src to end the run. With a nil sched it keeps pe.workers
+// submissions in flight; otherwise it sends on sched's open-loop schedule.
+// Results are counted in RunStats rather than kept, statuses and nonce
+// states are followed throughout, and the tracker forgets transactions
+// once they are final, so memory stays flat however long the run lasts.
+func (pe *ParallelExecutor) ExecuteFor(ctx context.Context, src RequestSource, d time.Duration, sched schedule.Scheduler) (RunStats, error) {
+	var stats RunStats
+	err := pe.StreamFor(ctx, src, d, sched, stats.Add)
+	return stats, err
+}
+
+// StreamFor is ExecuteFor passing each result to handle as soon as its
+// submission completes.
+func (pe *ParallelExecutor) StreamFor(ctx context.Context, src RequestSource, d time.Duration, sched schedule.Scheduler, handle ResultHandler) error {
+	emit := pe.emitter(handle)
+
+	pe.tracker.DropCompleted()
+	stopFollowing := make(chan bool)
+	var following sync.WaitGroup
+	following.Add(2)
+	go func() {
+		defer following.Done()
+		pe.tracker.Follow(ctx, stopFollowing)
+	}()
+	go func() {
+		defer following.Done()
+		pe.monitorExecutions(ctx, stopFollowing)
+	}()
+	defer following.Wait()
+	defer close(stopFollowing)
+
+	// submitCtx only stops new submissions; those in flight run on ctx
+	submitCtx, stopSubmitting := context.WithCancel(ctx)
+	if d > 0 {
+		submitCtx, stopSubmitting = context.WithTimeout(ctx, d)
+	}
+	defer stopSubmitting()
+
+	next := serialize(src)
+
+	if sched == nil {
+		var wg sync.WaitGroup
+		for w := 0; w < pe.workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for submitCtx.Err() == nil {
+					req, ok := next()
+					if !ok {
+						return
+					}
+					emit(pe.executeTransactionSequential(ctx, req.ID, req))
+				}
+			}()
+		}
+		wg.Wait()
+	} else {
+		schedule.Dispatch(submitCtx, sched, math.MaxInt, func(_ int, intended time.Time) {
+			req, ok := next()
+			if !ok {
+				stopSubmitting()
+				return
 			}
+			result := pe.executeTransactionSequential(ctx, req.ID, req)
+			result.ScheduledAt = intended
+			emit(result)
+		})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("transaction submission interrupted: %v", err)
+	}
+	return nil
+}
+
+// emitter returns the function every Stream method reports results through.
+// It starts tracking accepted transactions and then calls handle, one
+// result at a time.
+func (pe *ParallelExecutor) emitter(handle ResultHandler) func(TransactionResult) {
+	var mu sync.Mutex
+	return func(result TransactionResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Success {
+			pe.tracker.Track(metricstracker.Submission{
+				TxID:        result.TxID,
+				Node:        result.Node,
+				SubmittedAt: result.SentAt,
+				IntendedAt:  result.ScheduledAt,
+				Phase:       result.Phase,
+			})
 		}
+		if handle != nil {
+			handle(result)
+		}
+	}
+}
 
-		pe.nonceManager.MarkSubmitted(nonce, txID)
-		// logger.Metrics.Printf("Transaction %d submitted (nonce=%d) txID=%s", req.ID, nonce, txID)
+func (pe *ParallelExecutor) executeTransactionSequential(ctx context.Context, _ int, req TransactionRequest) TransactionResult {
+	if len(pe.signers) > 0 {
+		return pe.executeSigned(ctx, req)
+	}
 
+	startTime := time.Now()
+
+	lease, err := pe.acquireNode(ctx, nil)
+	if err != nil {
 		return TransactionResult{
 			ID:      req.ID,
-			Nonce:   nonce,
-			TxID:    txID,
-			Success: true,
+			Value:   req.Value,
+			Success: false,
+			Error:   fmt.Errorf("transaction not submitted: %v", err),
 			Latency: time.Since(startTime),
+			SentAt:  startTime,
 		}
 	}
+	node := lease.Node
+	nonceManager := pe.nonceManagers[node.Address]
+	// Retries may move to another node, but only one signing for the same
+	// account, since the nonce belongs to it.
+	sameAccount := func(n model.NodeInfo) bool { return n.Address == node.Address }
+
+	nonce := nonceManager.AllocateNonce()
+
+	logger.Metrics.Printf("Processing transaction %d with nonce %d on %s", req.ID, nonce, node.URL)
+
+	sub, err := pe.submit(ctx, req, node.Address, nonce, "", lease, sameAccount, func(node model.NodeInfo) (string, error) {
+		return pe.adapter.SubmitTransfer(ctx, node, rpc.Transfer{
+			Sender:   node.Address,
+			Receiver: req.Receiver,
+			Value:    req.Value,
+			Nonce:    nonce,
+		})
+	})
+	return pe.finish(ctx, req, nonceManager, nonce, sub, err, startTime)
+}
 
-	pe.nonceManager.MarkFailed(nonce)
-	return TransactionResult{
-		ID:      req.ID,
-		Nonce:   nonce,
-		Success: false,
-		Error:   fmt.Errorf("unexpected execution path"),
-		Latency: time.Since(startTime),
+// executeSigned signs the transfer locally with the next account key and
+// submits it raw to any node. Signing time is reported separately and is
+// not part of Latency.
+func (pe *ParallelExecutor) executeSigned(ctx context.Context, req TransactionRequest) TransactionResult {
+	key := pe.signers[(pe.nextSigner.Add(1)-1)%uint64(len(pe.signers))]
+	nonceManager := pe.nonceManagers[key.Address()]
+	nonce := nonceManager.AllocateNonce()
+
+	signStart := time.Now()
+	signed, err := key.Sign(signer.Transaction{
+		Sender:   key.Address(),
+		Receiver: req.Receiver,
+		Value:    req.Value,
+		Nonce:    nonce,
+	})
+	signLatency := time.Since(signStart)
+	if err != nil {
+		nonceManager.Release(nonce)
+		return TransactionResult{
+			ID:          req.ID,
+			Value:       req.Value,
+			Nonce:       nonce,
+			Sender:      key.Address(),
+			Success:     false,
+			Error:       fmt.Errorf("transaction not signed: %v", err),
+			SignLatency: signLatency,
+		}
 	}
+	raw := signed.Raw()
+
+	logger.Metrics.Printf("Processing transaction %d from %s with nonce %d (signed in %v)", req.ID, key.Address(), nonce, signLatency)
+
+	startTime := time.Now()
+	sub, err := pe.submit(ctx, req, key.Address(), nonce, signed.Hash(), nil, nil, func(node model.NodeInfo) (string, error) {
+		return pe.adapter.SubmitTransfer(ctx, node, rpc.Transfer{
+			Sender:   key.Address(),
+			Receiver: req.Receiver,
+			Value:    req.Value,
+			Nonce:    nonce,
+			Raw:      raw,
+		})
+	})
+	result := pe.finish(ctx, req, nonceManager, nonce, sub, err, startTime)
+	result.SignLatency = signLatency
+	return result
 }
 
-func (pe *ParallelExecutor) shouldRetry(err error) bool {
-	errStr := strings.ToLower(err.Error())
+// submitted is how a submission ended.
+type submitted struct {
+	txID string
+	// node is the node of the last attempt.
+	node    model.NodeInfo
+	retries int
+	// ambiguous is set when an attempt failed without telling whether the
+	// node accepted the transaction, and landed when the transaction was
+	// then found on a node.
+	ambiguous bool
+	landed    bool
+}
+
+// submit sends the transaction sender signs with nonce using send, on nodes
+// that accept allows, and retries retryable errors for as long as the retry
+// policy allows. lease, if not nil, is used for the first attempt. Once an attempt
+// has had an ambiguous outcome, every later failure first checks whether
+// the transaction landed after all, by hash if it was signed locally.
+func (pe *ParallelExecutor) submit(ctx context.Context, req TransactionRequest, sender string, nonce uint64, hash string,
+	lease *rpc.Lease, accept func(model.NodeInfo) bool, send func(model.NodeInfo) (string, error)) (submitted, error) {
+	var sub submitted
+	var tried []model.NodeInfo
+	backoff := pe.retry.Start()
+	for attempt := 1; ; attempt++ {
+		sub.retries = backoff.Retries()
+		if lease == nil {
+			var err error
+			lease, err = pe.acquireNode(ctx, accept)
+			if err != nil {
+				return sub, fmt.Errorf("transaction not submitted: %v", err)
+			}
+		}
+		sub.node = lease.Node
+		tried = append(tried, lease.Node)
+
+		txID, err := send(sub.node)
+		lease.Release(err)
+		lease = nil
+		if err == nil {
+			sub.txID = txID
+			return sub, nil
+		}
 
-	retryableErrors := []string{
-		"connection refused",
-		"timeout",
-		"temporary",
-		"network",
-		"502",
-		"503",
-		"504", 
+		if rpc.IsAmbiguous(err) {
+			sub.ambiguous = true
+		}
+		if sub.ambiguous && ctx.Err() == nil {
+			if status, node, ok := pe.findLanded(ctx, tried, sender, nonce, hash); ok {
+				logger.Metrics.Printf("Transaction %d (nonce=%d) landed on %s as %s (%s) although attempt %d failed: %v",
+					req.ID, nonce, node.URL, status.ID, status.Status, attempt, err)
+				sub.txID, sub.node, sub.landed = status.ID, node, true
+				return sub, nil
+			}
+		}
+
+		if ctx.Err() == nil && pe.shouldRetry(err) {
+			if delay, ok := backoff.Next(err); ok {
+				logger.Metrics.Printf("Transaction %d (nonce=%d) attempt %d on %s failed, retrying in %v: %v",
+					req.ID, nonce, attempt, sub.node.URL, delay.Round(time.Millisecond), err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+				continue
+			}
+		}
+		return sub, fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
 	}
+}
 
-	for _, retryable := range retryableErrors {
-		if strings.Contains(errStr, retryable) {
-			return true
+// findLanded looks for the transaction sender sent with nonce on each of
+// nodes, if the adapter can find transactions without their ID.
+func (pe *ParallelExecutor) findLanded(ctx context.Context, nodes []model.NodeInfo, sender string, nonce uint64,
+	hash string) (rpc.TxStatus, model.NodeInfo, bool) {
+	finder, ok := pe.adapter.(rpc.TransactionFinder)
+	if !ok {
+		return rpc.TxStatus{}, model.NodeInfo{}, false
+	}
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if seen[node.URL] {
+			continue
+		}
+		seen[node.URL] = true
+		status, err := finder.FindTransaction(ctx, node, sender, nonce, hash)
+		if err == nil {
+			return status, node, true
+		}
+		if !errors.Is(err, rpc.ErrNotFound) {
+			logger.Error.Printf("failed to look up nonce %d of %s on %s: %v", nonce, sender, node.URL, err)
 		}
 	}
+	return rpc.TxStatus{}, model.NodeInfo{}, false
+}
 
-	nonRetryableErrors := []string{
-		"nonce too low",
-		"nonce mismatch",
-		"invalid nonce",
-		"insufficient funds",
-		"invalid signature",
+// finish records the outcome of a submission with the nonce manager and
+// builds its result. The nonce of a failed submission is released for reuse
+// unless it may have reached the chain; a nonce error resyncs the manager
+// first, so that a nonce the chain has used up is not handed out again.
+func (pe *ParallelExecutor) finish(ctx context.Context, req TransactionRequest, nonceManager *nonce.NonceManager, nonce uint64,
+	sub submitted, err error, startTime time.Time) TransactionResult {
+	result := TransactionResult{
+		ID:        req.ID,
+		Value:     req.Value,
+		Nonce:     nonce,
+		Sender:    nonceManager.Address(),
+		Node:      sub.node.URL,
+		Latency:   time.Since(startTime),
+		SentAt:    startTime,
+		Retries:   sub.retries,
+		Ambiguous: sub.ambiguous,
+		Landed:    sub.landed,
+	}
+	if err != nil {
+		result.Error = err
+		switch {
+		case sub.ambiguous:
+			nonceManager.MarkFailed(nonce)
+		case errors.Is(err, rpc.ErrNonceTooLow), errors.Is(err, rpc.ErrNonceMismatch):
+			logger.Metrics.Printf("Nonce mismatch for %s at %d, resyncing: %v", nonceManager.Address(), nonce, err)
+			next, syncErr := nonceManager.Resync(ctx)
+			if syncErr != nil || nonce < next {
+				nonceManager.MarkFailed(nonce)
+			} else {
+				nonceManager.Release(nonce)
+			}
+		default:
+			nonceManager.Release(nonce)
+		}
+		return result
 	}
 
-	for _, nonRetryable := range nonRetryableErrors {
-		if strings.Contains(errStr, nonRetryable) {
-			return false
+	nonceManager.MarkSubmitted(nonce, sub.txID)
+	// logger.Metrics.Printf("Transaction %d submitted (nonce=%d) txID=%s", req.ID, nonce, txID)
+	result.TxID = sub.txID
+	result.Success = true
+	return result
+}
+
+// acquireNode leases a node from the pool, waiting up to pe.nodeWait for a
+// circuit to close if none is available.
+func (pe *ParallelExecutor) acquireNode(ctx context.Context, accept func(model.NodeInfo) bool) (*rpc.Lease, error) {
+	deadline := time.Now().Add(pe.nodeWait)
+	for {
+		lease, err := pe.pool.Acquire(accept)
+		if err == nil || !errors.Is(err, rpc.ErrNoNodeAvailable) || time.Now().After(deadline) {
+			return lease, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pe.pollInterval):
 		}
 	}
-	return true
 }
 
-func (pe *ParallelExecutor) WaitForCompletion() (int, int) {
+// UseSigners makes the executor sign transfers locally with keys, spreading
+// requests over the accounts, instead of relying on nodes to sign for their
+// configured address. Each account gets its own nonce sequence.
+func (pe *ParallelExecutor) UseSigners(ctx context.Context, keys []*signer.Key) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no signing keys provided")
+	}
+	node := pe.pool.Nodes()[0]
+	var addresses []string
+	recovered := false
+	for _, key := range keys {
+		if _, ok := pe.nonceManagers[key.Address()]; !ok {
+			nonceManager, err := nonce.NewNonceManager(ctx, pe.adapter, node, key.Address())
+			if err != nil {
+				return fmt.Errorf("failed to create nonce manager for %s: %v", key.Address(), err)
+			}
+			nonceManager.SetGapFiller(selfTransfer(pe.adapter, node, key.Address(), key), 0)
+			if pe.journal != nil {
+				if err := nonceManager.Recover(ctx, pe.journal); err != nil {
+					return fmt.Errorf("failed to recover nonces of %s: %v", key.Address(), err)
+				}
+				recovered = true
+			}
+			pe.nonceManagers[key.Address()] = nonceManager
+		}
+		addresses = append(addresses, key.Address())
+	}
+	if recovered {
+		if err := pe.journal.Compact(); err != nil {
+			return err
+		}
+	}
+	pe.signers = keys
+	pe.tracker.WatchSenders(addresses)
+	return nil
+}
+
+// UseJournal recovers the nonces of every sending account from journal,
+// reconciled with the chain, and records their transitions in it from then
+// on, so a run restarted after a crash neither reuses nor skips nonces.
+// The journal is then compacted to the records still needed. Accounts added
+// later by UseSigners are recovered as they are added. Call it before
+// submitting.
+func (pe *ParallelExecutor) UseJournal(ctx context.Context, journal *nonce.Journal) error {
+	for address, nonceManager := range pe.nonceManagers {
+		if err := nonceManager.Recover(ctx, journal); err != nil {
+			return fmt.Errorf("failed to recover nonces of %s: %v", address, err)
+		}
+	}
+	pe.journal = journal
+	return journal.Compact()
+}
+
+// SetRetryPolicy replaces the policy failed submissions are retried with,
+// rpc.DefaultRetryPolicy by default.
+func (pe *ParallelExecutor) SetRetryPolicy(policy rpc.RetryPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	pe.retry = policy
+	return nil
+}
+
+func (pe *ParallelExecutor) shouldRetry(err error) bool {
+	return rpc.IsRetryable(err)
+}
+
+func (pe *ParallelExecutor) WaitForCompletion(ctx context.Context) (int, int) {
 	logger.Metrics.Printf("Waiting for transaction completion...")
 
 	stopMonitoring := make(chan bool)
-	go pe.monitorExecutions(stopMonitoring)
+	go pe.monitorExecutions(ctx, stopMonitoring)
 
-	executed, finalized := pe.tracker.WaitAndCollect()
+	executed, finalized := pe.tracker.WaitAndCollect(ctx)
 
 	close(stopMonitoring)
 
@@ -195,7 +720,7 @@ func (pe *ParallelExecutor) WaitForCompletion() (int, int) {
 	return executed, finalized
 }
 
-func (pe *ParallelExecutor) monitorExecutions(stop <-chan bool) {
+func (pe *ParallelExecutor) monitorExecutions(ctx context.Context, stop <-chan bool) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -203,36 +728,76 @@ func (pe *ParallelExecutor) monitorExecutions(stop <-chan bool) {
 		select {
 		case <-stop:
 			return
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			pe.updateNonceStates()
+			pe.updateNonceStates(ctx)
 		}
 	}
 }
 
-func (pe *ParallelExecutor) updateNonceStates() {
-	states := pe.nonceManager.GetAllStates()
-
-	for nonce, state := range states {
-		state.Mutex.RLock()
-		submitted := state.Submitted
-		executed := state.Executed
-		txID := state.TxID
-		state.Mutex.RUnlock()
+func (pe *ParallelExecutor) updateNonceStates(ctx context.Context) {
+	for _, nonceManager := range pe.nonceManagers {
+		states := nonceManager.GetAllStates()
+
+		pending := make(map[string]uint64)
+		var txIDs []string
+		for nonce, state := range states {
+			state.Mutex.RLock()
+			submitted := state.Submitted
+			executed := state.Executed
+			txID := state.TxID
+			state.Mutex.RUnlock()
+
+			if submitted && !executed && txID != "" {
+				pending[txID] = nonce
+				txIDs = append(txIDs, txID)
+			}
+		}
 
-		if submitted && !executed && txID != "" {
-			detail, err := rpc.GetTransactionDetails(pe.node, txID)
-			if err != nil {
+		for txID, res := range pe.adapter.GetStatuses(ctx, nonceManager.Node(), txIDs) {
+			if res.Err != nil {
 				continue
 			}
 
-			if detail.ExecutionStatus == "SUCCESS" {
-				pe.nonceManager.MarkExecuted(nonce)
+			// A failed execution still consumes its nonce
+			if res.Status.Status.Executed() {
+				nonceManager.MarkExecuted(pending[txID])
+			}
+		}
+		nonceManager.Prune()
+		if err := nonceManager.CheckGaps(ctx); err != nil && ctx.Err() == nil {
+			logger.Error.Printf("failed to check nonce gaps of %s: %v", nonceManager.Address(), err)
+		}
+	}
+}
+
+// selfTransfer returns a gap filler that sends a zero-value transfer from
+// address to itself through node, signed with key if not nil.
+func selfTransfer(adapter rpc.ChainAdapter, node model.NodeInfo, address string, key *signer.Key) nonce.GapFiller {
+	return func(ctx context.Context, n uint64) (string, error) {
+		tx := rpc.Transfer{Sender: address, Receiver: address, Nonce: n}
+		if key != nil {
+			signed, err := key.Sign(signer.Transaction{Sender: address, Receiver: address, Nonce: n})
+			if err != nil {
+				return "", err
 			}
+			tx.Raw = signed.Raw()
 		}
+		return adapter.SubmitTransfer(ctx, node, tx)
 	}
 }
 
+// NonceGapStats totals the nonce gap events and recoveries of all sending
+// accounts.
+func (pe *ParallelExecutor) NonceGapStats() nonce.GapStats {
+	var total nonce.GapStats
+	for _, nonceManager := range pe.nonceManagers {
+		total.Add(nonceManager.GapStats())
+	}
+	return total
+}
+
 func (pe *ParallelExecutor) GetTracker() *metricstracker.Tracker {
 	return pe.tracker
 }
-
@@ -0,0 +1,212 @@
+package parallel
+
+import (
+	"context"
+	"math"
+	"metrics/logger"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitDiscard()
+	os.Exit(m.Run())
+}
+
+// newTestExecutor starts a mock node with cfg and an executor submitting
+// to it through the xygle adapter.
+func newTestExecutor(t *testing.T, cfg rpctest.Config, workers int) (*rpctest.Server, *ParallelExecutor) {
+	t.Helper()
+	if cfg.ExecutionDelay == nil {
+		cfg.ExecutionDelay = rpctest.Fixed(50 * time.Millisecond)
+	}
+	if cfg.FinalityDelay == nil {
+		cfg.FinalityDelay = rpctest.Fixed(50 * time.Millisecond)
+	}
+	srv := rpctest.NewServer(cfg)
+	t.Cleanup(srv.Close)
+
+	client := rpc.NewClient(rpc.ClientConfig{})
+	t.Cleanup(client.CloseIdleConnections)
+	// Injected failures must not open the circuit
+	pool, err := rpc.NewNodePool([]model.NodeInfo{srv.Node()}, rpc.RoundRobin, rpc.BreakerConfig{FailureRate: 1, MinRequests: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, err := NewParallelExecutor(context.Background(), rpc.NewXygleAdapter(client), pool, workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, pe
+}
+
+func transfers(n int, receiver string) []TransactionRequest {
+	requests := make([]TransactionRequest, n)
+	for i := range requests {
+		requests[i] = TransactionRequest{ID: i + 1, Receiver: receiver, Value: 1}
+	}
+	return requests
+}
+
+// run submits requests, waits for them to finalize and returns their
+// results in completion order.
+func run(t *testing.T, pe *ParallelExecutor, requests []TransactionRequest) ([]TransactionResult, RunStats) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Status events end the wait as soon as the last transfer is final
+	tracker := pe.GetTracker()
+	if err := tracker.ListenForEvents(ctx); err != nil {
+		t.Fatalf("ListenForEvents: %v", err)
+	}
+	defer tracker.Close()
+
+	var results []TransactionResult
+	var stats RunStats
+	err := pe.StreamTransactions(ctx, requests, func(result TransactionResult) {
+		results = append(results, result)
+		stats.Add(result)
+	})
+	if err != nil {
+		t.Fatalf("StreamTransactions: %v", err)
+	}
+	pe.WaitForCompletion(ctx)
+	return results, stats
+}
+
+func TestTransfersFinalize(t *testing.T) {
+	t.Parallel()
+	srv, pe := newTestExecutor(t, rpctest.Config{}, 4)
+
+	_, stats := run(t, pe, transfers(20, "0xreceiver"))
+	if stats.Successful != 20 || stats.Failed != 0 {
+		t.Fatalf("submissions: %d successful, %d failed; want 20, 0", stats.Successful, stats.Failed)
+	}
+	summary, err := pe.GetTracker().Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ExecutedCount != 20 || summary.FinalizedCount != 20 {
+		t.Errorf("tracker: %d executed, %d finalized; want 20, 20", summary.ExecutedCount, summary.FinalizedCount)
+	}
+	if got := srv.Nonce(rpctest.DefaultNodeAddress); got != 20 {
+		t.Errorf("account nonce = %d, want 20", got)
+	}
+	if got := srv.Balance("0xreceiver"); got != 20 {
+		t.Errorf("receiver balance = %d, want 20", got)
+	}
+}
+
+func TestNonceErrorReleasesNonce(t *testing.T) {
+	t.Parallel()
+	srv, pe := newTestExecutor(t, rpctest.Config{Failures: rpctest.Failures{NonceError: 0.3}, Seed: 1}, 1)
+
+	results, stats := run(t, pe, transfers(20, "0xreceiver"))
+	if stats.Failed == 0 {
+		t.Fatal("no nonce errors were injected")
+	}
+
+	// A rejected nonce is handed out again, so the accepted transfers use
+	// the nonces after the initial one without gaps
+	used := make(map[uint64]bool)
+	var lastSuccess int
+	for i, res := range results {
+		if res.Success {
+			if used[res.Nonce] {
+				t.Errorf("nonce %d used twice", res.Nonce)
+			}
+			used[res.Nonce] = true
+			lastSuccess = i
+		}
+	}
+	for i, res := range results[:lastSuccess] {
+		if !res.Success && !used[res.Nonce] {
+			t.Errorf("nonce %d of failed transaction %d was not reused", res.Nonce, i+1)
+		}
+	}
+	for n := uint64(1); n <= uint64(stats.Successful); n++ {
+		if !used[n] {
+			t.Errorf("nonce %d skipped", n)
+		}
+	}
+	if got := srv.Nonce(rpctest.DefaultNodeAddress); got != uint64(stats.Successful) {
+		t.Errorf("account nonce = %d, want %d", got, stats.Successful)
+	}
+}
+
+func TestLostReplyFoundLanded(t *testing.T) {
+	t.Parallel()
+	srv, pe := newTestExecutor(t, rpctest.Config{Failures: rpctest.Failures{LostReply: 0.3}, Seed: 2}, 2)
+
+	_, stats := run(t, pe, transfers(20, "0xreceiver"))
+	if stats.Ambiguous == 0 {
+		t.Fatal("no replies were lost")
+	}
+	if stats.Landed != stats.Ambiguous {
+		t.Errorf("%d of %d ambiguous submissions found landed, want all", stats.Landed, stats.Ambiguous)
+	}
+	if stats.Successful != 20 {
+		t.Errorf("%d successful submissions, want 20", stats.Successful)
+	}
+	// Landed transfers must not have been sent again
+	if got := srv.Stats().Transfers; got != 20 {
+		t.Errorf("node received %d transfers, want 20", got)
+	}
+	if got := srv.Balance("0xreceiver"); got != 20 {
+		t.Errorf("receiver balance = %d, want 20", got)
+	}
+}
+
+func TestServerErrorsRetried(t *testing.T) {
+	t.Parallel()
+	srv, pe := newTestExecutor(t, rpctest.Config{
+		Failures: rpctest.Failures{ServerError: 0.25, RateLimited: 0.25, RetryAfter: time.Second},
+		// Lets the executor read the account nonce at startup
+		Seed: 6,
+	}, 1)
+	err := pe.SetRetryPolicy(rpc.RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, stats := run(t, pe, transfers(10, "0xreceiver"))
+	if stats.Successful != 10 {
+		t.Fatalf("%d successful submissions, want 10", stats.Successful)
+	}
+	if stats.Retries == 0 {
+		t.Fatal("no submission was retried")
+	}
+	for _, res := range results {
+		// Every retry waited out the node's Retry-After, beyond MaxDelay
+		if res.Retries > 0 && res.Latency < time.Duration(res.Retries)*time.Second {
+			t.Errorf("transaction %d retried %d times in %v, want at least %ds", res.ID, res.Retries, res.Latency, res.Retries)
+		}
+	}
+	if got := srv.Balance("0xreceiver"); got != 10 {
+		t.Errorf("receiver balance = %d, want 10", got)
+	}
+}
+
+func TestValuesAboveMaxInt64(t *testing.T) {
+	t.Parallel()
+	srv, pe := newTestExecutor(t, rpctest.Config{
+		Balances: map[string]uint64{rpctest.DefaultNodeAddress: math.MaxUint64},
+	}, 1)
+
+	const value = math.MaxInt64 + 10
+	results, stats := run(t, pe, []TransactionRequest{{ID: 1, Receiver: "0xreceiver", Value: value}})
+	if stats.Successful != 1 {
+		t.Fatalf("%d successful submissions, want 1: %v", stats.Successful, results[0].Error)
+	}
+	if results[0].Value != value || stats.AcceptedValue != value {
+		t.Errorf("result value %d, accepted value %d; want %d", results[0].Value, stats.AcceptedValue, uint64(value))
+	}
+	if got := srv.Balance("0xreceiver"); got != value {
+		t.Errorf("receiver balance = %d, want %d", got, uint64(value))
+	}
+}
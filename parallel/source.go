@@ -0,0 +1,61 @@
+package parallel
+
+import "sync"
+
+// RequestSource yields the requests of a run one at a time, so a run of any
+// length need not build them up front. ok is false once the source is
+// exhausted. Executors never call Next concurrently.
+type RequestSource interface {
+	Next() (req TransactionRequest, ok bool)
+}
+
+type sliceSource struct {
+	requests []TransactionRequest
+}
+
+// SliceSource yields requests in order.
+func SliceSource(requests []TransactionRequest) RequestSource {
+	return &sliceSource{requests: requests}
+}
+
+func (s *sliceSource) Next() (TransactionRequest, bool) {
+	if len(s.requests) == 0 {
+		return TransactionRequest{}, false
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, true
+}
+
+type repeatSource struct {
+	template TransactionRequest
+	n        int
+	next     int
+}
+
+// Repeat yields copies of template with IDs counting up from 1, n of them,
+// or without end if n is zero.
+func Repeat(template TransactionRequest, n int) RequestSource {
+	return &repeatSource{template: template, n: n}
+}
+
+func (s *repeatSource) Next() (TransactionRequest, bool) {
+	if s.n > 0 && s.next >= s.n {
+		return TransactionRequest{}, false
+	}
+	s.next++
+	req := s.template
+	req.ID = s.next
+	return req, true
+}
+
+// serialize returns src.Next guarded so that concurrent submissions can
+// share src.
+func serialize(src RequestSource) func() (TransactionRequest, bool) {
+	var mu sync.Mutex
+	return func() (TransactionRequest, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return src.Next()
+	}
+}
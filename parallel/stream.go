@@ -0,0 +1,70 @@
+package parallel
+
+import "context"
+
+// ResultHandler receives the result of each submission as soon as it
+// completes. Calls are never concurrent and come in completion order; the
+// transaction, if accepted, is already being tracked. A slow handler holds
+// up the submissions waiting to report, so it should hand heavy work off.
+// To stop a run early, cancel the context it was started with.
+type ResultHandler func(TransactionResult)
+
+func collect(results *[]TransactionResult) ResultHandler {
+	return func(result TransactionResult) {
+		*results = append(*results, result)
+	}
+}
+
+// ResultStream delivers the results of a run on a channel.
+type ResultStream struct {
+	// Results is closed once the run has ended and every result has been
+	// delivered.
+	Results <-chan TransactionResult
+	cancel  context.CancelFunc
+	err     error
+}
+
+// NewResultStream starts run in the background with a context derived from
+// ctx, passing it a handler that forwards each result to the stream's
+// channel. For example:
+//
+//	stream := parallel.NewResultStream(ctx, func(ctx context.Context, h parallel.ResultHandler) error {
+//		return executor.StreamFor(ctx, src, 30*time.Minute, nil, h)
+//	})
+//	defer stream.Close()
+//	for result := range stream.Results {
+//		...
+//	}
+//
+// The channel is buffered, but a reader that falls far behind slows the run
+// down. A reader that stops early must call Close, which cancels the run and
+// drops the results it has yet to deliver; otherwise the run blocks once
+// the buffer is full.
+func NewResultStream(ctx context.Context, run func(context.Context, ResultHandler) error) *ResultStream {
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan TransactionResult, 1024)
+	rs := &ResultStream{Results: out, cancel: cancel}
+	go func() {
+		defer close(out)
+		defer cancel()
+		rs.err = run(ctx, func(result TransactionResult) {
+			select {
+			case out <- result:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return rs
+}
+
+// Close cancels the run if it is still going. Results is closed once the
+// run has returned.
+func (rs *ResultStream) Close() {
+	rs.cancel()
+}
+
+// Err returns the error the run ended with. It is only meaningful once
+// Results has been closed.
+func (rs *ResultStream) Err() error {
+	return rs.err
+}
@@ -0,0 +1,86 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// endless reports results until ctx is done.
+func endless(ctx context.Context, h ResultHandler) error {
+	for i := 1; ctx.Err() == nil; i++ {
+		h(TransactionResult{ID: i})
+	}
+	return ctx.Err()
+}
+
+// drained waits for the stream's channel to close.
+func drained(t *testing.T, stream *ResultStream) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-stream.Results:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("run did not end")
+		}
+	}
+}
+
+func TestResultStreamCloseCancelsRun(t *testing.T) {
+	t.Parallel()
+	stream := NewResultStream(context.Background(), endless)
+	for i := 1; i <= 3; i++ {
+		if result := <-stream.Results; result.ID != i {
+			t.Fatalf("result %d has ID %d", i, result.ID)
+		}
+	}
+
+	// The reader stops here; wait until the run is blocked on a full buffer
+	for len(stream.Results) < cap(stream.Results) {
+		time.Sleep(time.Millisecond)
+	}
+	stream.Close()
+	drained(t, stream)
+	if err := stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", err)
+	}
+}
+
+func TestResultStreamParentContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := NewResultStream(ctx, endless)
+	defer stream.Close()
+	<-stream.Results
+	cancel()
+	drained(t, stream)
+	if err := stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", err)
+	}
+}
+
+func TestResultStreamDeliversEverything(t *testing.T) {
+	t.Parallel()
+	stream := NewResultStream(context.Background(), func(ctx context.Context, h ResultHandler) error {
+		for i := 1; i <= 2000; i++ {
+			h(TransactionResult{ID: i})
+		}
+		return nil
+	})
+	defer stream.Close()
+	n := 0
+	for result := range stream.Results {
+		n++
+		if result.ID != n {
+			t.Fatalf("result %d has ID %d", n, result.ID)
+		}
+	}
+	if n != 2000 || stream.Err() != nil {
+		t.Errorf("%d results, err %v; want 2000, nil", n, stream.Err())
+	}
+}
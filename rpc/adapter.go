@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"metrics/models"
+	"strings"
+)
+
+// Status is a transaction's place in a chain-independent lifecycle.
+type Status int
+
+const (
+	// StatusUnknown means the node has not reported the transaction.
+	StatusUnknown Status = iota
+	// StatusPending means the node accepted the transaction but has not
+	// executed it yet.
+	StatusPending
+	// StatusExecuted means the transaction executed successfully and is not
+	// final yet.
+	StatusExecuted
+	// StatusFinal means the transaction executed successfully and can no
+	// longer be reverted.
+	StatusFinal
+	// StatusFailed means the transaction was executed but failed, or was
+	// reverted. It still consumed its nonce.
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusExecuted:
+		return "executed"
+	case StatusFinal:
+		return "final"
+	case StatusFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Executed reports whether the transaction has been applied, successfully
+// or not.
+func (s Status) Executed() bool {
+	return s == StatusExecuted || s == StatusFinal || s == StatusFailed
+}
+
+// TxStatus is the normalised status of one transaction.
+type TxStatus struct {
+	ID     string
+	Status Status
+	// ExecutedAt is the chain's execution time in unix seconds, zero if
+	// the transaction has not executed or the chain does not say.
+	ExecutedAt int64
+	// Detail is the status as the chain reported it, for logging.
+	Detail string
+}
+
+// StatusResult is the outcome of one lookup in GetStatuses.
+type StatusResult struct {
+	Status TxStatus
+	Err    error
+}
+
+// Transfer is a value transfer to submit. When Raw is set it is a
+// transaction already signed in the chain's own encoding, and the other
+// fields are informational; otherwise the node signs for Sender.
+type Transfer struct {
+	Sender   string
+	Receiver string
+	Value    uint64
+	Nonce    uint64
+	Raw      []byte
+}
+
+// ChainAdapter speaks one chain's JSON-RPC dialect, so submission and
+// tracking do not depend on method names or status fields. Unknown
+// transactions are reported as ErrNotFound.
+type ChainAdapter interface {
+	// Name is the chain name used in config, such as "xygle".
+	Name() string
+	// SubmitTransfer submits tx to node and returns its transaction ID.
+	SubmitTransfer(ctx context.Context, node model.NodeInfo, tx Transfer) (string, error)
+	GetStatus(ctx context.Context, node model.NodeInfo, txID string) (TxStatus, error)
+	// GetStatuses looks up txIDs, batching calls where the node allows it.
+	GetStatuses(ctx context.Context, node model.NodeInfo, txIDs []string) map[string]StatusResult
+	// GetNonce returns the nonce the next transaction of address must use.
+	GetNonce(ctx context.Context, node model.NodeInfo, address string) (uint64, error)
+	GetBalance(ctx context.Context, node model.NodeInfo, address string) (*big.Int, error)
+}
+
+// StatusSubscriber is implemented by adapters that can push status changes
+// from a node's WebSocket endpoint.
+type StatusSubscriber interface {
+	// SubscribeStatuses streams status changes of transactions sent by any
+	// of addresses over one connection to node.WSURL.
+	SubscribeStatuses(ctx context.Context, node model.NodeInfo, addresses []string) (*StatusStream, error)
+}
+
+// TransactionFinder is implemented by adapters that can find a submitted
+// transaction whose ID the submitter never received, such as when the
+// reply to the submission was lost.
+type TransactionFinder interface {
+	// FindTransaction returns the status of the transaction sender sent to
+	// node with nonce, or an ErrNotFound error if the node does not know
+	// it. hash, if not empty, is the hash of a transaction signed locally
+	// (see signer.Transaction.Hash), which the node uses as its ID.
+	FindTransaction(ctx context.Context, node model.NodeInfo, sender string, nonce uint64, hash string) (TxStatus, error)
+}
+
+// StatusStream is a live status subscription. Events is closed when the
+// connection drops or the stream is closed.
+type StatusStream struct {
+	Events <-chan TxStatus
+	close  func()
+}
+
+// Close cancels the subscription and closes its connection.
+func (s *StatusStream) Close() {
+	s.close()
+}
+
+// ChainConfig selects and tunes a chain adapter.
+type ChainConfig struct {
+	// Type is xygle (default) or ethereum.
+	Type string
+	// Confirmations, for ethereum, treats a transaction as final once its
+	// block is this many blocks deep. Zero uses the node's "finalized"
+	// block instead.
+	Confirmations uint64
+}
+
+// NewChainAdapter returns the adapter for cfg.Type, sending its calls
+// through client.
+func NewChainAdapter(client *Client, cfg ChainConfig) (ChainAdapter, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", "xygle":
+		return NewXygleAdapter(client), nil
+	case "ethereum", "eth", "evm":
+		return NewEthereumAdapter(client, cfg.Confirmations), nil
+	}
+	return nil, fmt.Errorf("unknown chain %q (want xygle or ethereum)", cfg.Type)
+}
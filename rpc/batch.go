@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"metrics/logger"
+	"metrics/models"
+	"net/http"
+	"time"
+)
+
+// ErrBatchUnsupported is returned by SendBatch when the node refuses JSON-RPC
+// batch requests: it answers with HTTP 400, 404, 405 or 501, or with a
+// single error object. Callers should fall back to single calls.
+var ErrBatchUnsupported = errors.New("node does not support JSON-RPC batch requests")
+
+// batchUnsupportedStatus reports whether an HTTP status in reply to a batch
+// means the node does not take batches, rather than a problem with this one
+// request, such as authentication or its size.
+func batchUnsupportedStatus(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// SendBatch sends reqs as a single JSON-RPC 2.0 batch and returns the
+// responses in request order, matched by ID. Requests without an ID are given
+// a fresh one; IDs must otherwise be unique within the batch. Per-call errors
+// are left in each response's Error field, and a request the node did not
+// answer gets a zero response with a nil ID.
+func (c *Client) SendBatch(ctx context.Context, url string, reqs []model.RequestToRPC) ([]model.ResponseFromRPC, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	index := make(map[uint64]int, len(reqs))
+	for i := range reqs {
+		if reqs[i].ID == 0 {
+			reqs[i].ID = nextRequestID()
+		}
+		if _, dup := index[reqs[i].ID]; dup {
+			return nil, fmt.Errorf("duplicate request ID %d in batch", reqs[i].ID)
+		}
+		index[reqs[i].ID] = i
+	}
+	// Batch-level errors are reported against the first request's ID.
+	batchReq := model.RequestToRPC{Method: fmt.Sprintf("batch[%d]", len(reqs)), ID: reqs[0].ID}
+
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal batch request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build batch request for %s: %v", url, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		rpcErr := transportError(ctx, batchReq, fmt.Errorf("failed to send batch request to %s: %w", url, err))
+		logger.Error.Println(rpcErr)
+		return nil, rpcErr
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		rpcErr := transportError(ctx, batchReq, fmt.Errorf("failed to read batch response: %w", err))
+		logger.Error.Println(rpcErr)
+		return nil, rpcErr
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if batchUnsupportedStatus(resp.StatusCode) {
+			return nil, fmt.Errorf("%w: HTTP status %d", ErrBatchUnsupported, resp.StatusCode)
+		}
+		rpcErr := &Error{
+			Kind:       classifyHTTPStatus(resp.StatusCode),
+			Method:     batchReq.Method,
+			RequestID:  batchReq.ID,
+			HTTPStatus: resp.StatusCode,
+			Message:    string(respBody),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		logger.Error.Println(rpcErr)
+		return nil, rpcErr
+	}
+
+	// A node without batch support answers the array with a single error object.
+	trimmed := bytes.TrimSpace(respBody)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		var single model.ResponseFromRPC
+		if err := json.Unmarshal(trimmed, &single); err == nil && single.Error != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBatchUnsupported, single.Error.Message)
+		}
+		return nil, &Error{
+			Kind:      ErrProtocol,
+			Method:    batchReq.Method,
+			RequestID: batchReq.ID,
+			Err:       fmt.Errorf("unexpected batch response: %s", string(respBody)),
+		}
+	}
+
+	var batch []model.ResponseFromRPC
+	if err := json.Unmarshal(trimmed, &batch); err != nil {
+		logger.Error.Printf("failed to unmarshal batch response: %v; body: %s", err, string(respBody))
+		return nil, &Error{
+			Kind:      ErrProtocol,
+			Method:    batchReq.Method,
+			RequestID: batchReq.ID,
+			Err:       fmt.Errorf("failed to unmarshal RPC batch response: %w", err),
+		}
+	}
+
+	results := make([]model.ResponseFromRPC, len(reqs))
+	seen := make([]bool, len(reqs))
+	for _, r := range batch {
+		if r.ID == nil {
+			logger.Error.Printf("%s (id=%d): ignoring batch response without ID", batchReq.Method, batchReq.ID)
+			continue
+		}
+		i, ok := index[*r.ID]
+		if !ok || seen[i] {
+			logger.Error.Printf("%s (id=%d): ignoring unexpected batch response ID %d", batchReq.Method, batchReq.ID, *r.ID)
+			continue
+		}
+		results[i] = r
+		seen[i] = true
+	}
+
+	LogLatency(batchReq.Method, batchReq.ID, time.Since(start))
+
+	return results, nil
+}
+
+// TransactionDetailsResult is the outcome of one lookup in a batched poll.
+type TransactionDetailsResult struct {
+	Detail model.TransactionResult
+	Err    error
+}
+
+// GetTransactionDetailsBatch looks up txIDs in batches of the client's batch
+// size. If the node rejects batches it falls back to single calls, and
+// remembers that for subsequent polls.
+func (c *Client) GetTransactionDetailsBatch(ctx context.Context, node model.NodeInfo, txIDs []string) map[string]TransactionDetailsResult {
+	reqs := make([]model.RequestToRPC, len(txIDs))
+	for i, txID := range txIDs {
+		reqs[i] = newRequest("xygle_getTransaction", map[string]interface{}{"id": txID})
+	}
+
+	results := make(map[string]TransactionDetailsResult, len(txIDs))
+	for i, res := range c.callAll(ctx, node, reqs) {
+		if res.err != nil {
+			results[txIDs[i]] = TransactionDetailsResult{Err: notFoundIfEmpty(res.err)}
+			continue
+		}
+		detail, err := decodeTransactionDetails(res.resp.Result)
+		results[txIDs[i]] = TransactionDetailsResult{Detail: detail, Err: err}
+	}
+	return results
+}
+
+// callResult is the outcome of one request sent by callAll.
+type callResult struct {
+	resp model.ResponseFromRPC
+	err  error
+}
+
+// callAll sends reqs to node in batches of the client's batch size and
+// returns the outcomes in request order, with JSON-RPC errors and empty
+// results reported as errors. If the node rejects batches it falls back to
+// single calls, and remembers that for subsequent calls. A batch rejected as
+// too large (HTTP 413) is sent again in halves.
+func (c *Client) callAll(ctx context.Context, node model.NodeInfo, reqs []model.RequestToRPC) []callResult {
+	results := make([]callResult, len(reqs))
+
+	for start := 0; start < len(reqs); start += c.batchSize {
+		if err := ctx.Err(); err != nil {
+			for i := start; i < len(reqs); i++ {
+				results[i].err = err
+			}
+			break
+		}
+		end := start + c.batchSize
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+		c.callChunk(ctx, node, reqs[start:end], results[start:end])
+	}
+
+	return results
+}
+
+// callChunk sends chunk as one batch, or as single calls if there is only
+// one request or the node does not take batches, and stores the outcomes in
+// out.
+func (c *Client) callChunk(ctx context.Context, node model.NodeInfo, chunk []model.RequestToRPC, out []callResult) {
+	if !c.batchEnabled(node.URL) || len(chunk) == 1 {
+		c.callEach(ctx, node, chunk, out)
+		return
+	}
+
+	responses, err := c.SendBatch(ctx, node.URL, chunk)
+	var rpcErr *Error
+	switch {
+	case errors.Is(err, ErrBatchUnsupported):
+		logger.Metrics.Printf("Node %s rejected batch requests, falling back to single calls: %v", node.URL, err)
+		c.noBatch.Store(node.URL, true)
+		c.callEach(ctx, node, chunk, out)
+		return
+	case errors.As(err, &rpcErr) && rpcErr.HTTPStatus == http.StatusRequestEntityTooLarge:
+		half := len(chunk) / 2
+		logger.Metrics.Printf("Node %s rejected a batch of %d as too large, sending it in halves", node.URL, len(chunk))
+		c.callChunk(ctx, node, chunk[:half], out[:half])
+		c.callChunk(ctx, node, chunk[half:], out[half:])
+		return
+	case err != nil:
+		for i := range out {
+			out[i].err = err
+		}
+		return
+	}
+
+	for i := range chunk {
+		if responses[i].ID == nil {
+			out[i].err = responseIDError(chunk[i], responses[i])
+			continue
+		}
+		out[i] = callResult{resp: responses[i], err: checkResponse(chunk[i], responses[i])}
+	}
+}
+
+func (c *Client) batchEnabled(url string) bool {
+	if c.batchSize <= 1 {
+		return false
+	}
+	_, rejected := c.noBatch.Load(url)
+	return !rejected
+}
+
+func (c *Client) callEach(ctx context.Context, node model.NodeInfo, reqs []model.RequestToRPC, out []callResult) {
+	for i, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			out[i].err = err
+			continue
+		}
+		resp, err := c.SendRequest(ctx, node.URL, req)
+		out[i] = callResult{resp: resp, err: err}
+	}
+}
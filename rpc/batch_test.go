@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"metrics/models"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// batchNode is a JSON-RPC node that answers every call with "<method>-<id>".
+// batch, if set, replies to array requests instead; it gets the calls and
+// returns the status and body to send.
+type batchNode struct {
+	mu      sync.Mutex
+	batches []int // sizes of the array requests seen
+	singles int
+	batch   func(calls []rawCall) (int, string)
+}
+
+func (n *batchNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var calls []rawCall
+	if json.Unmarshal(raw, &calls) != nil {
+		var c rawCall
+		json.Unmarshal(raw, &c)
+		n.mu.Lock()
+		n.singles++
+		n.mu.Unlock()
+		fmt.Fprint(w, answer(c))
+		return
+	}
+
+	n.mu.Lock()
+	n.batches = append(n.batches, len(calls))
+	n.mu.Unlock()
+	if n.batch != nil {
+		status, body := n.batch(calls)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+		return
+	}
+	fmt.Fprint(w, answerAll(calls))
+}
+
+func answer(c rawCall) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s-%s"}`, c.ID, c.Method, c.ID)
+}
+
+func answerAll(calls []rawCall) string {
+	out := "["
+	for i, c := range calls {
+		if i > 0 {
+			out += ","
+		}
+		out += answer(c)
+	}
+	return out + "]"
+}
+
+// newBatchClient serves node and returns a client with batchSize for it.
+func newBatchClient(t *testing.T, node *batchNode, batchSize int) (*Client, model.NodeInfo) {
+	t.Helper()
+	srv := httptest.NewServer(node)
+	t.Cleanup(srv.Close)
+	client := NewClient(ClientConfig{BatchSize: batchSize})
+	t.Cleanup(client.CloseIdleConnections)
+	return client, model.NodeInfo{URL: srv.URL}
+}
+
+func requests(n int) []model.RequestToRPC {
+	reqs := make([]model.RequestToRPC, n)
+	for i := range reqs {
+		reqs[i] = newRequest("test_call", map[string]interface{}{"i": i})
+	}
+	return reqs
+}
+
+// checkAnswered fails unless every result is the answer to its request.
+func checkAnswered(t *testing.T, reqs []model.RequestToRPC, results []callResult) {
+	t.Helper()
+	for i, res := range results {
+		if res.err != nil {
+			t.Errorf("request %d: %v", i, res.err)
+			continue
+		}
+		if want := fmt.Sprintf(`"test_call-%d"`, reqs[i].ID); string(res.resp.Result) != want {
+			t.Errorf("request %d: result %s, want %s", i, res.resp.Result, want)
+		}
+	}
+}
+
+func TestSendBatchMatchesResponsesByID(t *testing.T) {
+	node := &batchNode{batch: func(calls []rawCall) (int, string) {
+		// Reversed, with the first call unanswered and a stray ID
+		out := `[{"jsonrpc":"2.0","id":999999999,"result":"stray"},{"jsonrpc":"2.0","result":"no id"}`
+		for i := len(calls) - 1; i > 0; i-- {
+			out += "," + answer(calls[i])
+		}
+		return http.StatusOK, out + "]"
+	}}
+	client, nodeInfo := newBatchClient(t, node, 10)
+
+	reqs := requests(4)
+	responses, err := client.SendBatch(context.Background(), nodeInfo.URL, reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responses[0].ID != nil {
+		t.Errorf("unanswered request got a response with ID %d", *responses[0].ID)
+	}
+	for i := 1; i < len(reqs); i++ {
+		if want := fmt.Sprintf(`"test_call-%d"`, reqs[i].ID); string(responses[i].Result) != want {
+			t.Errorf("response %d = %s, want %s", i, responses[i].Result, want)
+		}
+	}
+
+	results := client.callAll(context.Background(), nodeInfo, requests(3))
+	if !errors.Is(results[0].err, ErrProtocol) {
+		t.Errorf("unanswered request in callAll: %v, want a protocol error", results[0].err)
+	}
+}
+
+func TestCallAllBatchSize(t *testing.T) {
+	node := &batchNode{}
+	client, nodeInfo := newBatchClient(t, node, 3)
+
+	reqs := requests(7)
+	checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+	if fmt.Sprint(node.batches) != "[3 3]" || node.singles != 1 {
+		t.Errorf("sent batches %v and %d single calls, want [3 3] and 1", node.batches, node.singles)
+	}
+
+	// A batch size of 1 turns batching off
+	node = &batchNode{}
+	client, nodeInfo = newBatchClient(t, node, 1)
+	checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+	if len(node.batches) != 0 || node.singles != 7 {
+		t.Errorf("with batch size 1, sent batches %v and %d single calls, want none and 7", node.batches, node.singles)
+	}
+}
+
+func TestCallAllFallsBackWithoutBatchSupport(t *testing.T) {
+	for name, reply := range map[string]func([]rawCall) (int, string){
+		"single error object": func([]rawCall) (int, string) {
+			return http.StatusOK, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch requests are not supported"}}`
+		},
+		"405": func([]rawCall) (int, string) { return http.StatusMethodNotAllowed, "" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			node := &batchNode{batch: reply}
+			client, nodeInfo := newBatchClient(t, node, 10)
+
+			reqs := requests(3)
+			checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+			reqs = requests(3)
+			checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+			if len(node.batches) != 1 || node.singles != 6 {
+				t.Errorf("sent %d batches and %d single calls, want 1 and 6", len(node.batches), node.singles)
+			}
+		})
+	}
+}
+
+func TestCallAllKeepsBatchingAfterAuthError(t *testing.T) {
+	var mu sync.Mutex
+	denied := true
+	node := &batchNode{}
+	node.batch = func(calls []rawCall) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if denied {
+			denied = false
+			return http.StatusUnauthorized, "missing token"
+		}
+		return http.StatusOK, answerAll(calls)
+	}
+	client, nodeInfo := newBatchClient(t, node, 10)
+
+	for _, res := range client.callAll(context.Background(), nodeInfo, requests(3)) {
+		var rpcErr *Error
+		if !errors.As(res.err, &rpcErr) || rpcErr.HTTPStatus != http.StatusUnauthorized {
+			t.Errorf("result error = %v, want HTTP 401", res.err)
+		}
+	}
+	reqs := requests(3)
+	checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+	if len(node.batches) != 2 || node.singles != 0 {
+		t.Errorf("sent %d batches and %d single calls, want 2 and none", len(node.batches), node.singles)
+	}
+}
+
+func TestCallAllHalvesTooLargeBatches(t *testing.T) {
+	node := &batchNode{batch: func(calls []rawCall) (int, string) {
+		if len(calls) > 2 {
+			return http.StatusRequestEntityTooLarge, "too large"
+		}
+		return http.StatusOK, answerAll(calls)
+	}}
+	client, nodeInfo := newBatchClient(t, node, 8)
+
+	reqs := requests(8)
+	checkAnswered(t, reqs, client.callAll(context.Background(), nodeInfo, reqs))
+	if fmt.Sprint(node.batches) != "[8 4 2 2 4 2 2]" {
+		t.Errorf("sent batches %v, want [8 4 2 2 4 2 2]", node.batches)
+	}
+	if !client.batchEnabled(nodeInfo.URL) {
+		t.Error("batching turned off after a 413")
+	}
+}
@@ -0,0 +1,451 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// CassetteEntry is one recorded HTTP round trip. A cassette is a file of
+// entries, one JSON object per line, in the order the responses completed.
+type CassetteEntry struct {
+	Time    time.Time     `json:"time"`
+	Latency time.Duration `json:"latency"`
+	URL     string        `json:"url"`
+	// Method is the JSON-RPC method, or "batch" for a batch request.
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status,omitempty"`
+	Header   http.Header     `json:"header,omitempty"`
+	Response string          `json:"response,omitempty"`
+	// Error is set instead of Status and Response when the round trip
+	// failed without a reply.
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that forwards to next and appends every
+// round trip to a cassette file.
+type Recorder struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewRecorder(path string, next http.RoundTripper) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassette: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next, file: f}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := CassetteEntry{
+		Time:    time.Now(),
+		URL:     req.URL.String(),
+		Method:  jsonrpcMethod(body),
+		Request: json.RawMessage(body),
+	}
+	if !json.Valid(body) {
+		entry.Request, _ = json.Marshal(string(body))
+	}
+
+	resp, err := r.next.RoundTrip(out)
+	if err != nil {
+		entry.Latency = time.Since(entry.Time)
+		entry.Error = err.Error()
+		if werr := r.write(entry); werr != nil {
+			return nil, werr
+		}
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	entry.Latency = time.Since(entry.Time)
+	entry.Status = resp.StatusCode
+	entry.Header = resp.Header.Clone()
+	entry.Response = string(respBody)
+	if err := r.write(entry); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// write appends entry to the cassette. A failed write fails the round trip,
+// so a run never silently leaves an incomplete cassette behind.
+func (r *Recorder) write(entry CassetteEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette entry: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the cassette file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Sync(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+func LoadCassette(path string) ([]CassetteEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer f.Close()
+
+	var entries []CassetteEntry
+	dec := json.NewDecoder(f)
+	for {
+		var e CassetteEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read cassette entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// replayCall is the recorded answer to a single JSON-RPC call. Batches are
+// split into their calls so a replayed run may group calls differently.
+type replayCall struct {
+	at      time.Duration // since the first entry of the cassette
+	latency time.Duration
+	status  int
+	header  http.Header
+	body    string          // raw reply for non-2xx statuses
+	result  json.RawMessage // response object for this call, nil if missing
+	err     string
+	// batchFailure marks calls whose whole batch was rejected; only
+	// replayed batches are answered with them.
+	batchFailure bool
+}
+
+// Replayer is an http.RoundTripper that answers JSON-RPC calls from a
+// cassette instead of a node. Calls are matched by URL, method and params,
+// ignoring the request ID, and responses are rewritten to carry the ID of
+// the replayed request. Submissions are matched by URL and method only and
+// answered in recorded order, so a replayed run finds them even when its
+// workload picks other receivers or values than the recorded one.
+//
+// Repeated calls, such as polls of one transaction, are answered in
+// recorded order. With a positive speed each call gets the latest response
+// that was recorded by the same point on the replay clock, and replies are
+// delayed by their recorded latency, both scaled by speed (1 is real time,
+// 2 twice as fast). With speed 0 responses are served one per call without
+// delay.
+type Replayer struct {
+	speed float64
+
+	mu      sync.Mutex
+	calls   map[string][]replayCall
+	cursors map[string]int
+	start   time.Time
+}
+
+func NewReplayer(entries []CassetteEntry, speed float64) *Replayer {
+	r := &Replayer{
+		speed:   speed,
+		calls:   make(map[string][]replayCall),
+		cursors: make(map[string]int),
+	}
+	if len(entries) == 0 {
+		return r
+	}
+
+	origin := entries[0].Time
+	for _, e := range entries {
+		base := replayCall{
+			at:      e.Time.Sub(origin),
+			latency: e.Latency,
+			status:  e.Status,
+			header:  e.Header,
+			body:    e.Response,
+			err:     e.Error,
+		}
+		ok := e.Error == "" && e.Status >= 200 && e.Status < 300
+
+		var batch []rawCall
+		if err := json.Unmarshal(e.Request, &batch); err != nil {
+			var single rawCall
+			if err := json.Unmarshal(e.Request, &single); err != nil {
+				continue
+			}
+			call := base
+			if ok {
+				call.result = json.RawMessage(e.Response)
+			}
+			key := callKey(e.URL, single)
+			r.calls[key] = append(r.calls[key], call)
+			continue
+		}
+
+		var results map[string]json.RawMessage
+		var resps []json.RawMessage
+		if ok && json.Unmarshal([]byte(e.Response), &resps) != nil {
+			// A non-array reply means the node rejected the batch.
+			ok = false
+		}
+		if ok {
+			results = make(map[string]json.RawMessage)
+			for _, resp := range resps {
+				var head struct {
+					ID json.RawMessage `json:"id"`
+				}
+				if json.Unmarshal(resp, &head) == nil {
+					results[string(head.ID)] = resp
+				}
+			}
+		}
+		for _, c := range batch {
+			call := base
+			if ok {
+				call.result = results[string(c.ID)]
+			} else {
+				call.batchFailure = true
+			}
+			key := callKey(e.URL, c)
+			r.calls[key] = append(r.calls[key], call)
+		}
+	}
+	return r
+}
+
+// rawCall is a JSON-RPC request as seen on the wire.
+type rawCall struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	url := req.URL.String()
+
+	r.mu.Lock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	elapsed := time.Since(r.start)
+
+	var batch []rawCall
+	isBatch := json.Unmarshal(body, &batch) == nil
+	if !isBatch {
+		var single rawCall
+		if err := json.Unmarshal(body, &single); err != nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("replay: cannot parse request: %w", err)
+		}
+		batch = []rawCall{single}
+	}
+
+	calls := make([]replayCall, len(batch))
+	for i, c := range batch {
+		call, ok := r.next(callKey(url, c), isBatch, submitMethods[c.Method], elapsed)
+		if !ok {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("replay: no recorded response for %s %s", url, c.Method)
+		}
+		calls[i] = call
+	}
+	r.mu.Unlock()
+
+	var latency time.Duration
+	for _, call := range calls {
+		if call.latency > latency {
+			latency = call.latency
+		}
+	}
+	if err := r.wait(req.Context(), latency); err != nil {
+		return nil, err
+	}
+
+	for _, call := range calls {
+		if call.err != "" {
+			return nil, errors.New(call.err)
+		}
+		if call.batchFailure || call.status < 200 || call.status >= 300 {
+			return replayResponse(req, call.status, call.header, []byte(call.body)), nil
+		}
+	}
+
+	if !isBatch {
+		return replayResponse(req, calls[0].status, calls[0].header, withID(calls[0].result, batch[0].ID)), nil
+	}
+	var out []json.RawMessage
+	for i, call := range calls {
+		if call.result != nil {
+			out = append(out, withID(call.result, batch[i].ID))
+		}
+	}
+	data, _ := json.Marshal(out)
+	return replayResponse(req, http.StatusOK, nil, data), nil
+}
+
+// next picks the recorded answer for key, the next one in recorded order if
+// inOrder is set. Callers hold r.mu.
+func (r *Replayer) next(key string, batch, inOrder bool, elapsed time.Duration) (replayCall, bool) {
+	var eligible []replayCall
+	for _, c := range r.calls[key] {
+		if batch || !c.batchFailure {
+			eligible = append(eligible, c)
+		}
+	}
+	if len(eligible) == 0 {
+		return replayCall{}, false
+	}
+
+	cursorKey := key
+	if batch {
+		cursorKey = "batch " + key
+	}
+	i := r.cursors[cursorKey]
+	if r.speed <= 0 || inOrder {
+		if i+1 < len(eligible) {
+			r.cursors[cursorKey] = i + 1
+		}
+		return eligible[i], true
+	}
+
+	recorded := time.Duration(float64(elapsed) * r.speed)
+	for i+1 < len(eligible) && eligible[i+1].at <= recorded {
+		i++
+	}
+	r.cursors[cursorKey] = i
+	return eligible[i], true
+}
+
+func (r *Replayer) wait(ctx context.Context, latency time.Duration) error {
+	if r.speed <= 0 || latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(float64(latency) / r.speed))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// submitMethods are the methods that submit a transaction. Their params
+// depend on the workload, so they are replayed by method and order.
+var submitMethods = map[string]bool{
+	"xygle_transferFund":       true,
+	"xygle_sendRawTransaction": true,
+	"eth_sendRawTransaction":   true,
+	"eth_sendTransaction":      true,
+}
+
+// callKey identifies a call by URL, method and params, or by URL and method
+// for submissions. Params are re-encoded so that formatting differences do
+// not matter.
+func callKey(url string, c rawCall) string {
+	if submitMethods[c.Method] {
+		return url + " " + c.Method
+	}
+	params := []byte(c.Params)
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(c.Params))
+	dec.UseNumber()
+	if dec.Decode(&v) == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			params = canonical
+		}
+	}
+	return url + " " + c.Method + " " + string(params)
+}
+
+// withID returns resp with its "id" member replaced by id.
+func withID(resp, id json.RawMessage) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &obj); err != nil {
+		return resp
+	}
+	obj["id"] = id
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return resp
+	}
+	return out
+}
+
+// replayResponse builds the reply to req with the recorded header, so that
+// headers such as Retry-After survive the replay.
+func replayResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+func jsonrpcMethod(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return "batch"
+	}
+	var c rawCall
+	json.Unmarshal(body, &c)
+	return c.Method
+}
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTrip posts reqBody through rt and returns the reply status, its
+// Retry-After header and its body.
+func roundTrip(t *testing.T, rt http.RoundTripper, url, reqBody string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("Retry-After"), string(body)
+}
+
+func TestCassetteReplaysHeadersAndSubmissions(t *testing.T) {
+	limited := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			limited = false
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xtx1"}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	rec, err := NewRecorder(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submit := `{"jsonrpc":"2.0","id":1,"method":"xygle_transferFund","params":{"receiver":"0xa","value":1,"nonce":1}}`
+	roundTrip(t, rec, srv.URL, submit)
+	roundTrip(t, rec, srv.URL, submit)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := NewReplayer(entries, 0)
+	// An unseeded workload sends other params than the recorded run
+	other := `{"jsonrpc":"2.0","id":7,"method":"xygle_transferFund","params":{"receiver":"0xb","value":5,"nonce":1}}`
+	status, retryAfter, _ := roundTrip(t, replay, srv.URL, other)
+	if status != http.StatusTooManyRequests || retryAfter != "3" {
+		t.Errorf("first replay: status %d, Retry-After %q; want 429, 3", status, retryAfter)
+	}
+	status, _, body := roundTrip(t, replay, srv.URL, other)
+	if status != http.StatusOK || !strings.Contains(body, `"0xtx1"`) || !strings.Contains(body, `"id":7`) {
+		t.Errorf("second replay: status %d, body %s; want the recorded transaction ID", status, body)
+	}
+}
+
+func TestRecorderReturnsWriteErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+	}))
+	defer srv.Close()
+
+	rec, err := NewRecorder(filepath.Join(t.TempDir(), "run.jsonl"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.file.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"xygle_getNodeStats","params":{}}`))
+	if resp, err := rec.RoundTrip(req); err == nil {
+		resp.Body.Close()
+		t.Error("RoundTrip succeeded with an unwritable cassette")
+	}
+}
@@ -2,72 +2,295 @@ package rpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"metrics/logger"
+	"metrics/models"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
-    "metrics/logger"
-	"metrics/models"
 )
 
-func SendRequestToRPC(url string, req model.RequestToRPC) (model.ResponseFromRPC, error) {
+// ClientConfig tunes the HTTP transport used for every RPC call. Zero values
+// fall back to the defaults from DefaultClientConfig.
+type ClientConfig struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	RequestTimeout        time.Duration
+	// BatchSize caps the number of calls packed into one JSON-RPC batch.
+	// Set it to 1 to disable batching.
+	BatchSize int
+	// Endpoints holds per-node headers and TLS settings, keyed by node URL.
+	// An entry applies to requests to exactly that URL, so nodes behind one
+	// gateway can differ by path; add the node's WebSocket URL as an entry
+	// of its own.
+	Endpoints map[string]Endpoint
+	// Transport replaces the pooled transport built from the settings
+	// above, for example with a Recorder or Replayer.
+	Transport http.RoundTripper
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		DialTimeout:           5 * time.Second,
+		KeepAlive:             30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		RequestTimeout:        30 * time.Second,
+		BatchSize:             100,
+	}
+}
+
+func (cfg ClientConfig) withDefaults() ClientConfig {
+	def := DefaultClientConfig()
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = def.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = def.DialTimeout
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = def.KeepAlive
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout <= 0 {
+		cfg.ResponseHeaderTimeout = def.ResponseHeaderTimeout
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = def.RequestTimeout
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	return cfg
+}
+
+// Client sends JSON-RPC requests over a single pooled HTTP transport. It is
+// safe for concurrent use and should be shared by every component of a run.
+type Client struct {
+	httpClient *http.Client
+	batchSize  int
+	// endpoints is keyed by endpointKey, for WebSocket dials.
+	endpoints map[string]Endpoint
+	// noBatch records node URLs that rejected a batch request.
+	noBatch sync.Map
+}
+
+func NewClient(cfg ClientConfig) *Client {
+	cfg = cfg.withDefaults()
+
+	transport := cfg.Transport
+	if transport == nil {
+		transport = NewTransport(cfg)
+	}
+	endpoints := make(map[string]Endpoint, len(cfg.Endpoints))
+	for nodeURL, ep := range cfg.Endpoints {
+		endpoints[endpointKey(nodeURL)] = ep
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.RequestTimeout,
+		},
+		batchSize: cfg.BatchSize,
+		endpoints: endpoints,
+	}
+}
+
+// NewTransport builds the pooled HTTP transport NewClient uses when
+// cfg.Transport is nil, applying cfg.Endpoints to requests to those nodes.
+func NewTransport(cfg ClientConfig) http.RoundTripper {
+	cfg = cfg.withDefaults()
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	base := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+	if len(cfg.Endpoints) == 0 {
+		return base
+	}
+	return newEndpointTransport(base, cfg.Endpoints)
+}
+
+// CloseIdleConnections releases pooled keep-alive connections.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+var requestID atomic.Uint64
+
+// nextRequestID returns a process-wide unique, monotonically increasing ID.
+func nextRequestID() uint64 {
+	return requestID.Add(1)
+}
+
+// newRequest builds a JSON-RPC 2.0 request with a fresh ID.
+func newRequest(method string, params interface{}) model.RequestToRPC {
+	return model.RequestToRPC{
+		JSONRPC: "2.0",
+		ID:      nextRequestID(),
+		Method:  method,
+		Params:  params,
+	}
+}
+
+// SendRequest posts req to url and validates that the response answers it.
+// A request without an ID is given a fresh one.
+func (c *Client) SendRequest(ctx context.Context, url string, req model.RequestToRPC) (model.ResponseFromRPC, error) {
 	var rpcResp model.ResponseFromRPC
 
+	if req.ID == 0 {
+		req.ID = nextRequestID()
+	}
+
 	body, err := json.Marshal(req)
 	if err != nil {
 		return rpcResp, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return rpcResp, fmt.Errorf("failed to build request for %s: %v", url, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
 	start := time.Now()
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	resp, err := c.httpClient.Do(httpReq)
 
 	if err != nil {
-		err = fmt.Errorf("failed to send request to %s: %v", url, err)
-		logger.Error.Println(err)
-		return rpcResp, err
+		rpcErr := transportError(ctx, req, fmt.Errorf("failed to send request to %s: %w", url, err))
+		logger.Error.Println(rpcErr)
+		return rpcResp, rpcErr
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		respBody, _ := io.ReadAll(resp.Body)
-		err := fmt.Errorf("RPC HTTP status %d: %s", resp.StatusCode, string(respBody))
-		logger.Error.Println(err)
-		return rpcResp, err
+		rpcErr := &Error{
+			Kind:       classifyHTTPStatus(resp.StatusCode),
+			Method:     req.Method,
+			RequestID:  req.ID,
+			HTTPStatus: resp.StatusCode,
+			Message:    string(respBody),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		logger.Error.Println(rpcErr)
+		return rpcResp, rpcErr
 	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		err = fmt.Errorf("failed to read response: %v", err)
-		logger.Error.Println(err)
-		return rpcResp, err
+		rpcErr := transportError(ctx, req, fmt.Errorf("failed to read response: %w", err))
+		logger.Error.Println(rpcErr)
+		return rpcResp, rpcErr
 	}
 
 	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
 		logger.Error.Printf("failed to unmarshal response: %v; body: %s", err, string(respBody))
-		return rpcResp, fmt.Errorf("failed to unmarshal RPC response: %v", err)
+		return rpcResp, &Error{
+			Kind:      ErrProtocol,
+			Method:    req.Method,
+			RequestID: req.ID,
+			Err:       fmt.Errorf("failed to unmarshal RPC response: %w", err),
+		}
 	}
 
-	if rpcResp.Error != nil {
-		err := fmt.Errorf("RPC error: %s (data: %s)", rpcResp.Error.Message, rpcResp.Error.Data)
+	if rpcResp.ID == nil || *rpcResp.ID != req.ID {
+		err := responseIDError(req, rpcResp)
 		logger.Error.Println(err)
 		return rpcResp, err
 	}
 
-	if len(rpcResp.Result) == 0 || string(rpcResp.Result) == "null" {
-		err := fmt.Errorf("RPC returned empty result for method %s", req.Method)
+	if err := checkResponse(req, rpcResp); err != nil {
 		logger.Error.Println(err)
 		return rpcResp, err
 	}
 
 	// Log latency only for successful attempts
 	latency := time.Since(start)
-	LogLatency(req.Method, latency)
+	LogLatency(req.Method, req.ID, latency)
 
 	return rpcResp, nil
 }
 
+// checkResponse reports a JSON-RPC level error or an empty result.
+func checkResponse(req model.RequestToRPC, rpcResp model.ResponseFromRPC) error {
+	if e := rpcResp.Error; e != nil {
+		return &Error{
+			Kind:      classifyRPCError(e.Code, e.Message, e.Data),
+			Method:    req.Method,
+			RequestID: req.ID,
+			Code:      e.Code,
+			Message:   e.Message,
+			Data:      e.Data,
+		}
+	}
+	if len(rpcResp.Result) == 0 || string(rpcResp.Result) == "null" {
+		return &Error{
+			Kind:      ErrEmptyResult,
+			Method:    req.Method,
+			RequestID: req.ID,
+			Err:       fmt.Errorf("RPC returned empty result for method %s", req.Method),
+		}
+	}
+	return nil
+}
+
+// responseIDError reports a response whose ID is missing or does not match
+// the request. Any JSON-RPC error the node sent is kept in the message.
+func responseIDError(req model.RequestToRPC, rpcResp model.ResponseFromRPC) *Error {
+	cause := fmt.Errorf("missing response ID for request ID %d", req.ID)
+	if rpcResp.ID != nil {
+		cause = fmt.Errorf("response ID %d does not match request ID %d", *rpcResp.ID, req.ID)
+	}
+	rpcErr := &Error{
+		Kind:      ErrProtocol,
+		Method:    req.Method,
+		RequestID: req.ID,
+		Err:       cause,
+	}
+	if e := rpcResp.Error; e != nil {
+		rpcErr.Code = e.Code
+		rpcErr.Message = e.Message
+		rpcErr.Data = e.Data
+	}
+	return rpcErr
+}
+
 // LogLatency logs latency for an RPC call
-func LogLatency(method string, duration time.Duration) {
-	logger.Metrics.Printf("Latency for %s = %v", method, duration)
+func LogLatency(method string, id uint64, duration time.Duration) {
+	logger.Metrics.Printf("Latency for %s (id=%d) = %v", method, id, duration)
 }
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendRequestChecksResponseID(t *testing.T) {
+	for name, tc := range map[string]struct {
+		reply string // %s is the request ID
+		want  string
+	}{
+		"mismatched ID": {`{"jsonrpc":"2.0","id":12345678,"result":"ok"}`, "does not match request ID"},
+		"missing ID":    {`{"jsonrpc":"2.0","result":"ok"}`, "missing response ID"},
+		"null ID":       {`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`, "missing response ID"},
+		"matching ID":   {`{"jsonrpc":"2.0","id":%s,"result":"ok"}`, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var c rawCall
+				if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+					t.Error(err)
+				}
+				reply := tc.reply
+				if strings.Contains(reply, "%s") {
+					reply = fmt.Sprintf(reply, c.ID)
+				}
+				fmt.Fprint(w, reply)
+			}))
+			defer srv.Close()
+			client := NewClient(ClientConfig{})
+			defer client.CloseIdleConnections()
+
+			_, err := client.SendRequest(context.Background(), srv.URL, newRequest("test_call", nil))
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("SendRequest() = %v, want no error", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("SendRequest() = %v, want a protocol error containing %q", err, tc.want)
+			}
+			if name == "null ID" && !strings.Contains(err.Error(), "parse error") {
+				t.Errorf("error %q lost the node's JSON-RPC error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Endpoint holds the credentials and TLS settings of one node. Header is
+// set on every request to the node, replacing any value the client would
+// send, and TLS replaces the default TLS configuration of its connections.
+type Endpoint struct {
+	Header http.Header
+	TLS    *tls.Config
+}
+
+// TLSFiles locates a node's TLS material on disk.
+type TLSFiles struct {
+	// CAFile is a PEM bundle trusted instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile hold a PEM client certificate and key for
+	// mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the server certificate is checked
+	// against.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Load builds the TLS configuration described by f, or returns nil if f is
+// empty.
+func (f TLSFiles) Load() (*tls.Config, error) {
+	if f == (TLSFiles{}) {
+		return nil, nil
+	}
+	if (f.CertFile == "") != (f.KeyFile == "") {
+		return nil, fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         f.ServerName,
+		InsecureSkipVerify: f.InsecureSkipVerify,
+	}
+	if f.CAFile != "" {
+		pem, err := os.ReadFile(f.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", f.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if f.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// endpointKey identifies the node a URL belongs to by its full URL, with
+// scheme and host lowercased, default ports made explicit and any trailing
+// slash dropped.
+func endpointKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return urlKey(u)
+}
+
+func urlKey(u *url.URL) string {
+	key := strings.ToLower(u.Scheme) + "://" + hostKey(u) + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+func hostKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https", "wss":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// endpointTransport applies per-node headers and TLS settings. Nodes with
+// their own TLS configuration get their own connection pool.
+type endpointTransport struct {
+	base   *http.Transport
+	routes map[string]endpointRoute
+}
+
+type endpointRoute struct {
+	header    http.Header
+	transport *http.Transport
+}
+
+func newEndpointTransport(base *http.Transport, endpoints map[string]Endpoint) *endpointTransport {
+	t := &endpointTransport{base: base, routes: make(map[string]endpointRoute)}
+	for nodeURL, ep := range endpoints {
+		route := endpointRoute{header: ep.Header, transport: base}
+		if ep.TLS != nil {
+			route.transport = base.Clone()
+			route.transport.TLSClientConfig = ep.TLS
+		}
+		t.routes[endpointKey(nodeURL)] = route
+	}
+	return t
+}
+
+func (t *endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route, ok := t.routes[urlKey(req.URL)]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	if len(route.header) > 0 {
+		req = req.Clone(req.Context())
+		for name, values := range route.header {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+	return route.transport.RoundTrip(req)
+}
+
+func (t *endpointTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+	for _, route := range t.routes {
+		route.transport.CloseIdleConnections()
+	}
+}
+
+// DialWS connects to a node's WebSocket endpoint with the headers and TLS
+// settings configured for it.
+func (c *Client) DialWS(ctx context.Context, url string) (*WSClient, error) {
+	ep := c.endpoints[endpointKey(url)]
+	return dialWS(ctx, url, ep.TLS, ep.Header)
+}
@@ -0,0 +1,188 @@
+package rpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes one PEM block to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert creates a CA and a client certificate signed by it, and
+// returns the CA's pool with the paths of the certificate and key files.
+func newClientCert(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "metrics"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// caFile writes the mock node's certificate out as a CA bundle.
+func caFile(t *testing.T, srv *rpctest.Server, dir string) string {
+	t.Helper()
+	return writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+}
+
+// getNonce reads the node's account nonce through a client for endpoints.
+func getNonce(endpoints map[string]rpc.Endpoint, node model.NodeInfo) error {
+	client := rpc.NewClient(rpc.ClientConfig{Endpoints: endpoints})
+	defer client.CloseIdleConnections()
+	_, err := rpc.NewXygleAdapter(client).GetNonce(context.Background(), node, node.Address)
+	return err
+}
+
+func TestEndpointCustomCA(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.Config{TLS: true})
+	defer srv.Close()
+
+	if err := getNonce(nil, srv.Node()); err == nil {
+		t.Fatal("call succeeded without trusting the node's certificate")
+	}
+	tlsConfig, err := rpc.TLSFiles{CAFile: caFile(t, srv, t.TempDir())}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getNonce(map[string]rpc.Endpoint{srv.URL(): {TLS: tlsConfig}}, srv.Node()); err != nil {
+		t.Errorf("call with the node's CA: %v", err)
+	}
+}
+
+func TestEndpointClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	clientCAs, certFile, keyFile := newClientCert(t, dir)
+	srv := rpctest.NewServer(rpctest.Config{TLS: true, ClientCAs: clientCAs})
+	defer srv.Close()
+	ca := caFile(t, srv, dir)
+
+	serverOnly, err := rpc.TLSFiles{CAFile: ca}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getNonce(map[string]rpc.Endpoint{srv.URL(): {TLS: serverOnly}}, srv.Node()); err == nil {
+		t.Fatal("call succeeded without a client certificate")
+	}
+	mutual, err := rpc.TLSFiles{CAFile: ca, CertFile: certFile, KeyFile: keyFile}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getNonce(map[string]rpc.Endpoint{srv.URL(): {TLS: mutual}}, srv.Node()); err != nil {
+		t.Errorf("call with a client certificate: %v", err)
+	}
+}
+
+func TestEndpointRequireHeader(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.Config{RequireHeader: http.Header{"X-Api-Key": {"secret"}}})
+	defer srv.Close()
+	node := srv.Node()
+
+	err := getNonce(nil, node)
+	var rpcErr *rpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.HTTPStatus != http.StatusUnauthorized {
+		t.Fatalf("call without the header: %v, want HTTP 401", err)
+	}
+	if rpc.IsRetryable(err) {
+		t.Error("401 is retryable")
+	}
+
+	ep := rpc.Endpoint{Header: http.Header{"X-Api-Key": {"secret"}}}
+	endpoints := map[string]rpc.Endpoint{node.URL: ep, node.WSURL: ep}
+	if err := getNonce(endpoints, node); err != nil {
+		t.Errorf("call with the header: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := rpc.NewClient(rpc.ClientConfig{Endpoints: endpoints})
+	defer client.CloseIdleConnections()
+	ws, err := client.DialWS(ctx, node.WSURL)
+	if err != nil {
+		t.Fatalf("WebSocket handshake with the header: %v", err)
+	}
+	ws.Close()
+	if ws, err := rpc.DialWS(ctx, node.WSURL); err == nil {
+		ws.Close()
+		t.Error("WebSocket handshake succeeded without the header")
+	}
+}
+
+// Nodes behind one gateway share host and port and differ by path.
+func TestEndpointsKeyedByURL(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.Config{RequireHeader: http.Header{"X-Api-Key": {"secret"}}})
+	defer srv.Close()
+	withKey := srv.Node()
+	withKey.URL = srv.URL() + "/node-a"
+	without := srv.Node()
+	without.URL = srv.URL() + "/node-b"
+
+	endpoints := map[string]rpc.Endpoint{withKey.URL + "/": {Header: http.Header{"X-Api-Key": {"secret"}}}}
+	if err := getNonce(endpoints, withKey); err != nil {
+		t.Errorf("call to the configured node: %v", err)
+	}
+	if err := getNonce(endpoints, without); err == nil {
+		t.Error("another node on the same host got the configured header")
+	}
+}
@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"metrics/models"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error kinds. Every *Error carries at most one of them, so callers can
+// classify failures with errors.Is instead of inspecting message text.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrNonceMismatch     = errors.New("nonce mismatch")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrTransport         = errors.New("transport error")
+	ErrTimeout           = errors.New("timeout")
+	ErrUnavailable       = errors.New("node unavailable")
+	ErrEmptyResult       = errors.New("empty result")
+	ErrProtocol          = errors.New("protocol error")
+	// ErrCanceled marks a call abandoned because its context was canceled,
+	// whatever cause the cancellation carries. It matches context.Canceled.
+	ErrCanceled = fmt.Errorf("request canceled: %w", context.Canceled)
+)
+
+// Error describes a failed RPC call. RequestID is the JSON-RPC ID sent to the
+// node, HTTPStatus is set for non-2xx replies, Code/Message/Data mirror the
+// JSON-RPC error object and Err holds the underlying transport or decoding
+// error.
+type Error struct {
+	Kind       error
+	Method     string
+	RequestID  uint64
+	HTTPStatus int
+	Code       int
+	Message    string
+	Data       string
+	Err        error
+	// RetryAfter is the wait the node asked for with a Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Method != "" {
+		b.WriteString(e.Method)
+		if e.RequestID != 0 {
+			fmt.Fprintf(&b, " (id=%d)", e.RequestID)
+		}
+		b.WriteString(": ")
+	}
+	switch {
+	case e.Err != nil && e.Kind == ErrProtocol:
+		b.WriteString(e.Err.Error())
+		if e.Message != "" {
+			fmt.Fprintf(&b, " (RPC error %d: %s)", e.Code, e.Message)
+		}
+	case e.HTTPStatus != 0:
+		fmt.Fprintf(&b, "RPC HTTP status %d: %s", e.HTTPStatus, e.Message)
+	case e.Code != 0 || e.Message != "":
+		fmt.Fprintf(&b, "RPC error %d: %s", e.Code, e.Message)
+		if e.Data != "" {
+			fmt.Fprintf(&b, " (data: %s)", e.Data)
+		}
+	case e.Err != nil:
+		b.WriteString(e.Err.Error())
+	case e.Kind != nil:
+		b.WriteString(e.Kind.Error())
+	default:
+		b.WriteString("RPC call failed")
+	}
+	return b.String()
+}
+
+// Unwrap exposes both the kind and the underlying cause to errors.Is/As.
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+var (
+	codeKindsMu sync.RWMutex
+	codeKinds   = map[int]error{}
+)
+
+// RegisterErrorCode maps a node-specific JSON-RPC error code to an error kind.
+// Codes without a mapping are classified from the error message.
+func RegisterErrorCode(code int, kind error) {
+	codeKindsMu.Lock()
+	defer codeKindsMu.Unlock()
+	codeKinds[code] = kind
+}
+
+// messageKinds is the fallback for nodes that report everything under a
+// generic code. Order matters: the first match wins.
+var messageKinds = []struct {
+	text string
+	kind error
+}{
+	{"nonce too low", ErrNonceTooLow},
+	{"nonce mismatch", ErrNonceMismatch},
+	{"invalid nonce", ErrNonceMismatch},
+	{"insufficient funds", ErrInsufficientFunds},
+	{"invalid signature", ErrInvalidSignature},
+	{"not found", ErrNotFound},
+}
+
+func classifyRPCError(code int, message, data string) error {
+	codeKindsMu.RLock()
+	kind, ok := codeKinds[code]
+	codeKindsMu.RUnlock()
+	if ok {
+		return kind
+	}
+
+	text := strings.ToLower(message + " " + data)
+	for _, mk := range messageKinds {
+		if strings.Contains(text, mk.text) {
+			return mk.kind
+		}
+	}
+	return nil
+}
+
+func classifyHTTPStatus(status int) error {
+	if status == 429 || status >= 500 {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// transportError classifies err, a failed round trip of req made under ctx.
+func transportError(ctx context.Context, req model.RequestToRPC, err error) *Error {
+	kind := ErrTransport
+	var netErr net.Error
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		// Neither the node's fault nor a sign the call reached it
+		kind = ErrCanceled
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		kind = ErrTimeout
+	}
+	return &Error{Kind: kind, Method: req.Method, RequestID: req.ID, Err: err}
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying with
+// the same request: a timeout, a transport error, or an HTTP 429 or 5xx
+// reply. Anything else, including cancellation, other HTTP errors and
+// JSON-RPC errors, would fail the same way again.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, ErrTransport) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+}
+
+// IsAmbiguous reports whether err leaves open if a submission reached the
+// node: the request timed out or the connection failed, so the node may
+// have accepted it without the reply arriving.
+func IsAmbiguous(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrTransport)
+}
@@ -0,0 +1,394 @@
+package rpc
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"metrics/logger"
+	"metrics/models"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EthereumAdapter is the ChainAdapter for nodes speaking Ethereum-style
+// JSON-RPC. Signed transfers go out with eth_sendRawTransaction and must be
+// encoded for that chain; unsigned ones use eth_sendTransaction, which needs
+// the node to hold the sender's key, as development nodes do.
+//
+// A transaction is executed once it has a receipt, failed if the receipt
+// status is 0x0, and final once its block is finalized or, with
+// confirmations set, that many blocks deep.
+type EthereumAdapter struct {
+	client        *Client
+	confirmations uint64
+	// blockTimes caches block timestamps by block number.
+	blockTimes sync.Map
+}
+
+func NewEthereumAdapter(client *Client, confirmations uint64) *EthereumAdapter {
+	return &EthereumAdapter{client: client, confirmations: confirmations}
+}
+
+func (a *EthereumAdapter) Name() string {
+	return "ethereum"
+}
+
+func (a *EthereumAdapter) SubmitTransfer(ctx context.Context, node model.NodeInfo, tx Transfer) (string, error) {
+	var req model.RequestToRPC
+	if len(tx.Raw) > 0 {
+		req = newRequest("eth_sendRawTransaction", []interface{}{"0x" + hex.EncodeToString(tx.Raw)})
+	} else {
+		req = newRequest("eth_sendTransaction", []interface{}{map[string]interface{}{
+			"from":  tx.Sender,
+			"to":    tx.Receiver,
+			"value": hexQuantity(tx.Value),
+			"nonce": hexQuantity(tx.Nonce),
+		}})
+	}
+
+	resp, err := a.client.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return "", err
+	}
+	var hash string
+	if err := decodeResult(req, resp, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (a *EthereumAdapter) GetStatus(ctx context.Context, node model.NodeInfo, txID string) (TxStatus, error) {
+	res := a.GetStatuses(ctx, node, []string{txID})[txID]
+	return res.Status, res.Err
+}
+
+// ethReceipt holds the fields of eth_getTransactionReceipt the adapter uses.
+type ethReceipt struct {
+	BlockNumber string `json:"blockNumber"`
+	// Status is 0x1 on success and 0x0 on failure; nodes from before
+	// Byzantium leave it out.
+	Status string `json:"status"`
+}
+
+// GetStatuses fetches the receipts of txIDs, then the finalized block and
+// the timestamps of any blocks not seen before. A transaction without a
+// receipt is looked up with eth_getTransactionByHash: it is pending if the
+// node knows it and ErrNotFound otherwise.
+func (a *EthereumAdapter) GetStatuses(ctx context.Context, node model.NodeInfo, txIDs []string) map[string]StatusResult {
+	results := make(map[string]StatusResult, len(txIDs))
+
+	reqs := make([]model.RequestToRPC, len(txIDs))
+	for i, txID := range txIDs {
+		reqs[i] = newRequest("eth_getTransactionReceipt", []interface{}{txID})
+	}
+
+	blocks := make(map[string]uint64)
+	var unmined []string
+	for i, res := range a.client.callAll(ctx, node, reqs) {
+		txID := txIDs[i]
+		if errors.Is(res.err, ErrEmptyResult) {
+			unmined = append(unmined, txID)
+			continue
+		}
+		if res.err != nil {
+			results[txID] = StatusResult{Err: res.err}
+			continue
+		}
+
+		var receipt ethReceipt
+		if err := decodeResult(reqs[i], res.resp, &receipt); err != nil {
+			results[txID] = StatusResult{Err: err}
+			continue
+		}
+		if receipt.BlockNumber == "" {
+			unmined = append(unmined, txID)
+			continue
+		}
+		number, err := parseQuantity(receipt.BlockNumber)
+		if err != nil || !number.IsUint64() {
+			results[txID] = StatusResult{Err: &Error{Kind: ErrProtocol, Method: reqs[i].Method, RequestID: reqs[i].ID,
+				Err: fmt.Errorf("invalid block number %q", receipt.BlockNumber)}}
+			continue
+		}
+
+		st := TxStatus{ID: txID, Status: StatusExecuted, Detail: "status " + receipt.Status}
+		if receipt.Status == "0x0" {
+			st.Status = StatusFailed
+		}
+		results[txID] = StatusResult{Status: st}
+		blocks[txID] = number.Uint64()
+	}
+	a.pendingStatuses(ctx, node, unmined, results)
+	if len(blocks) == 0 {
+		return results
+	}
+
+	final, err := a.finalizedBlock(ctx, node)
+	if err != nil {
+		logger.Error.Printf("failed to read finalized block from %s: %v", node.URL, err)
+	}
+	times := a.blockTimestamps(ctx, node, blocks)
+
+	for txID, number := range blocks {
+		res := results[txID]
+		res.Status.ExecutedAt = times[number]
+		if err == nil && number <= final && res.Status.Status == StatusExecuted {
+			res.Status.Status = StatusFinal
+		}
+		results[txID] = res
+	}
+	return results
+}
+
+// ethTransaction holds the fields of a transaction object the adapter
+// uses.
+type ethTransaction struct {
+	Hash  string `json:"hash"`
+	From  string `json:"from"`
+	Nonce string `json:"nonce"`
+}
+
+// pendingStatuses reports txIDs, which have no receipt, as pending if the
+// node knows them and as ErrNotFound if it does not.
+func (a *EthereumAdapter) pendingStatuses(ctx context.Context, node model.NodeInfo, txIDs []string, results map[string]StatusResult) {
+	if len(txIDs) == 0 {
+		return
+	}
+	reqs := make([]model.RequestToRPC, len(txIDs))
+	for i, txID := range txIDs {
+		reqs[i] = newRequest("eth_getTransactionByHash", []interface{}{txID})
+	}
+	for i, res := range a.client.callAll(ctx, node, reqs) {
+		txID := txIDs[i]
+		if res.err != nil {
+			results[txID] = StatusResult{Err: notFoundIfEmpty(res.err)}
+			continue
+		}
+		var tx ethTransaction
+		if err := decodeResult(reqs[i], res.resp, &tx); err != nil {
+			results[txID] = StatusResult{Err: err}
+			continue
+		}
+		results[txID] = StatusResult{Status: TxStatus{ID: txID, Status: StatusPending, Detail: "no receipt"}}
+	}
+}
+
+// findBlocks bounds how many recent blocks FindTransaction searches.
+const findBlocks = 128
+
+// FindTransaction looks a locally signed transaction up by its hash. Any
+// other is searched for by sender and nonce in the pending block and the
+// most recent findBlocks blocks, unless the node's pending transaction
+// count shows that sender has not used nonce.
+func (a *EthereumAdapter) FindTransaction(ctx context.Context, node model.NodeInfo, sender string, nonce uint64, hash string) (TxStatus, error) {
+	if hash != "" {
+		if !strings.HasPrefix(hash, "0x") {
+			hash = "0x" + hash
+		}
+		return a.GetStatus(ctx, node, hash)
+	}
+	notFound := &Error{Kind: ErrNotFound, Method: "eth_getBlockByNumber",
+		Message: fmt.Sprintf("no transaction from %s with nonce %d", sender, nonce)}
+
+	next, err := a.GetNonce(ctx, node, sender)
+	if err != nil {
+		return TxStatus{}, err
+	}
+	if nonce >= next {
+		return TxStatus{}, notFound
+	}
+
+	req := newRequest("eth_blockNumber", []interface{}{})
+	resp, err := a.client.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return TxStatus{}, err
+	}
+	var latest string
+	if err := decodeResult(req, resp, &latest); err != nil {
+		return TxStatus{}, err
+	}
+	head, err := quantityUint64(req, latest)
+	if err != nil {
+		return TxStatus{}, err
+	}
+
+	reqs := []model.RequestToRPC{newRequest("eth_getBlockByNumber", []interface{}{"pending", true})}
+	for n := head; n > 0 && head-n < findBlocks; n-- {
+		reqs = append(reqs, newRequest("eth_getBlockByNumber", []interface{}{hexQuantity(n), true}))
+	}
+	// A block that cannot be read only matters if the transaction is not
+	// found in the others
+	var blockErr error
+	for i, res := range a.client.callAll(ctx, node, reqs) {
+		var block struct {
+			Transactions []ethTransaction `json:"transactions"`
+		}
+		err := res.err
+		if err == nil {
+			err = decodeResult(reqs[i], res.resp, &block)
+		}
+		if err != nil {
+			if blockErr == nil && !errors.Is(err, ErrEmptyResult) {
+				blockErr = err
+			}
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if !strings.EqualFold(tx.From, sender) {
+				continue
+			}
+			if n, err := quantityUint64(reqs[i], tx.Nonce); err == nil && n == nonce {
+				return a.GetStatus(ctx, node, tx.Hash)
+			}
+		}
+	}
+	if blockErr != nil {
+		return TxStatus{}, blockErr
+	}
+	return TxStatus{}, notFound
+}
+
+// finalizedBlock returns the number of the newest final block.
+func (a *EthereumAdapter) finalizedBlock(ctx context.Context, node model.NodeInfo) (uint64, error) {
+	if a.confirmations == 0 {
+		req := newRequest("eth_getBlockByNumber", []interface{}{"finalized", false})
+		resp, err := a.client.SendRequest(ctx, node.URL, req)
+		if err != nil {
+			return 0, err
+		}
+		var block struct {
+			Number string `json:"number"`
+		}
+		if err := decodeResult(req, resp, &block); err != nil {
+			return 0, err
+		}
+		return quantityUint64(req, block.Number)
+	}
+
+	req := newRequest("eth_blockNumber", []interface{}{})
+	resp, err := a.client.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return 0, err
+	}
+	var latest string
+	if err := decodeResult(req, resp, &latest); err != nil {
+		return 0, err
+	}
+	head, err := quantityUint64(req, latest)
+	if err != nil {
+		return 0, err
+	}
+	if head+1 < a.confirmations {
+		return 0, fmt.Errorf("chain is %d blocks long, fewer than %d confirmations", head+1, a.confirmations)
+	}
+	return head + 1 - a.confirmations, nil
+}
+
+// blockTimestamps returns the timestamps of the blocks in numbers, fetching
+// those not cached. Blocks that cannot be read get zero.
+func (a *EthereumAdapter) blockTimestamps(ctx context.Context, node model.NodeInfo, numbers map[string]uint64) map[uint64]int64 {
+	times := make(map[uint64]int64)
+	var missing []uint64
+	for _, number := range numbers {
+		if _, seen := times[number]; seen {
+			continue
+		}
+		if ts, ok := a.blockTimes.Load(number); ok {
+			times[number] = ts.(int64)
+			continue
+		}
+		times[number] = 0
+		missing = append(missing, number)
+	}
+	if len(missing) == 0 {
+		return times
+	}
+
+	reqs := make([]model.RequestToRPC, len(missing))
+	for i, number := range missing {
+		reqs[i] = newRequest("eth_getBlockByNumber", []interface{}{hexQuantity(number), false})
+	}
+	for i, res := range a.client.callAll(ctx, node, reqs) {
+		if res.err != nil {
+			continue
+		}
+		var block struct {
+			Timestamp string `json:"timestamp"`
+		}
+		if decodeResult(reqs[i], res.resp, &block) != nil {
+			continue
+		}
+		ts, err := quantityUint64(reqs[i], block.Timestamp)
+		if err != nil {
+			continue
+		}
+		a.blockTimes.Store(missing[i], int64(ts))
+		times[missing[i]] = int64(ts)
+	}
+	return times
+}
+
+// GetNonce returns the transaction count of address including pending
+// transactions, which is the nonce of its next transaction.
+func (a *EthereumAdapter) GetNonce(ctx context.Context, node model.NodeInfo, address string) (uint64, error) {
+	req := newRequest("eth_getTransactionCount", []interface{}{address, "pending"})
+	resp, err := a.client.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return 0, err
+	}
+	var count string
+	if err := decodeResult(req, resp, &count); err != nil {
+		return 0, err
+	}
+	return quantityUint64(req, count)
+}
+
+func (a *EthereumAdapter) GetBalance(ctx context.Context, node model.NodeInfo, address string) (*big.Int, error) {
+	req := newRequest("eth_getBalance", []interface{}{address, "latest"})
+	resp, err := a.client.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return nil, err
+	}
+	var balance string
+	if err := decodeResult(req, resp, &balance); err != nil {
+		return nil, err
+	}
+	n, err := parseQuantity(balance)
+	if err != nil {
+		return nil, &Error{Kind: ErrProtocol, Method: req.Method, RequestID: req.ID, Err: err}
+	}
+	return n, nil
+}
+
+// hexQuantity encodes v as an Ethereum JSON-RPC quantity.
+func hexQuantity(v uint64) string {
+	return "0x" + strconv.FormatUint(v, 16)
+}
+
+// parseQuantity decodes a 0x-prefixed hex quantity.
+func parseQuantity(s string) (*big.Int, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("quantity %q is not 0x-prefixed", s)
+	}
+	n, ok := new(big.Int).SetString(s[2:], 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n, nil
+}
+
+// quantityUint64 decodes a quantity returned for req, reporting malformed
+// values as ErrProtocol.
+func quantityUint64(req model.RequestToRPC, s string) (uint64, error) {
+	n, err := parseQuantity(s)
+	if err == nil && !n.IsUint64() {
+		err = fmt.Errorf("quantity %s does not fit in uint64", n)
+	}
+	if err != nil {
+		return 0, &Error{Kind: ErrProtocol, Method: req.Method, RequestID: req.ID, Err: err}
+	}
+	return n.Uint64(), nil
+}
@@ -0,0 +1,231 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"metrics/signer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newEthereumNode starts a mock node whose transactions execute after 100ms
+// and become final after finality, and an Ethereum adapter for it.
+func newEthereumNode(t *testing.T, finality time.Duration, balances map[string]uint64) (*rpctest.Server, *rpc.EthereumAdapter) {
+	t.Helper()
+	srv := rpctest.NewServer(rpctest.Config{
+		Balances:       balances,
+		ExecutionDelay: rpctest.Fixed(100 * time.Millisecond),
+		FinalityDelay:  rpctest.Fixed(finality),
+	})
+	t.Cleanup(srv.Close)
+	client := rpc.NewClient(rpc.ClientConfig{})
+	t.Cleanup(client.CloseIdleConnections)
+	return srv, rpc.NewEthereumAdapter(client, 0)
+}
+
+// waitStatus polls txID until it reaches want.
+func waitStatus(t *testing.T, adapter rpc.ChainAdapter, node model.NodeInfo, txID string, want rpc.Status) rpc.TxStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := adapter.GetStatus(context.Background(), node, txID)
+		if err == nil && st.Status == want {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status of %s = %v (err %v), want %v", txID, st.Status, err, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestEthereumStatuses(t *testing.T) {
+	srv, adapter := newEthereumNode(t, time.Hour, nil)
+	node := srv.Node()
+	ctx := context.Background()
+
+	txID := transfer(t, adapter, node, 1)
+	const unknown = "0x00000000000000000000000000000000000000000000000000000000000000aa"
+	results := adapter.GetStatuses(ctx, node, []string{txID, unknown})
+	if res := results[txID]; res.Err != nil || res.Status.Status != rpc.StatusPending {
+		t.Errorf("submitted transaction: %v (err %v), want pending", res.Status.Status, res.Err)
+	}
+	if res := results[unknown]; !errors.Is(res.Err, rpc.ErrNotFound) {
+		t.Errorf("unknown transaction: %v (err %v), want ErrNotFound", res.Status.Status, res.Err)
+	}
+
+	// Finality is an hour away, so the transaction stays executed
+	st := waitStatus(t, adapter, node, txID, rpc.StatusExecuted)
+	if st.ExecutedAt == 0 {
+		t.Error("executed transaction has no execution time")
+	}
+	if got := srv.Balance("0xreceiver"); got != 1 {
+		t.Errorf("receiver balance = %d, want 1", got)
+	}
+}
+
+func TestEthereumFinality(t *testing.T) {
+	srv, adapter := newEthereumNode(t, 50*time.Millisecond, nil)
+	node := srv.Node()
+	txID := transfer(t, adapter, node, 1)
+	waitStatus(t, adapter, node, txID, rpc.StatusFinal)
+
+	// One block deep is final with one confirmation, whatever the node's
+	// finalized block
+	client := rpc.NewClient(rpc.ClientConfig{})
+	defer client.CloseIdleConnections()
+	waitStatus(t, rpc.NewEthereumAdapter(client, 1), node, txID, rpc.StatusFinal)
+}
+
+func TestEthereumNonceAndBalance(t *testing.T) {
+	srv, adapter := newEthereumNode(t, time.Hour, nil)
+	node := srv.Node()
+	ctx := context.Background()
+
+	next, err := adapter.GetNonce(ctx, node, node.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 1 {
+		t.Fatalf("next nonce = %d, want 1", next)
+	}
+	transfer(t, adapter, node, 1)
+	transfer(t, adapter, node, 2)
+	// Queued transactions count towards the next nonce
+	if next, err = adapter.GetNonce(ctx, node, node.Address); err != nil || next != 3 {
+		t.Fatalf("next nonce with two pending = %d (err %v), want 3", next, err)
+	}
+
+	balance, err := adapter.GetBalance(ctx, node, node.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.IsUint64() || balance.Uint64() != rpctest.DefaultBalance {
+		t.Errorf("balance = %v, want %d", balance, rpctest.DefaultBalance)
+	}
+}
+
+func TestEthereumFindTransaction(t *testing.T) {
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, adapter := newEthereumNode(t, time.Hour, map[string]uint64{key.Address(): 100})
+	node := srv.Node()
+	ctx := context.Background()
+
+	txID := transfer(t, adapter, node, 1)
+	// Still in the pending block
+	st, err := adapter.FindTransaction(ctx, node, node.Address, 1, "")
+	if err != nil {
+		t.Fatalf("pending transaction: %v", err)
+	}
+	if st.ID != txID || st.Status != rpc.StatusPending {
+		t.Errorf("pending transaction: found %s %v, want %s pending", st.ID, st.Status, txID)
+	}
+	waitStatus(t, adapter, node, txID, rpc.StatusExecuted)
+	if st, err = adapter.FindTransaction(ctx, node, node.Address, 1, ""); err != nil || st.ID != txID || st.Status != rpc.StatusExecuted {
+		t.Errorf("executed transaction: found %s %v (err %v), want %s executed", st.ID, st.Status, err, txID)
+	}
+	if _, err := adapter.FindTransaction(ctx, node, node.Address, 2, ""); !errors.Is(err, rpc.ErrNotFound) {
+		t.Errorf("unused nonce: err = %v, want ErrNotFound", err)
+	}
+
+	signed, err := key.Sign(signer.Transaction{Sender: key.Address(), Receiver: "0xreceiver", Value: 1, Nonce: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.FindTransaction(ctx, node, key.Address(), 1, signed.Hash()); !errors.Is(err, rpc.ErrNotFound) {
+		t.Errorf("unsent signed transaction: err = %v, want ErrNotFound", err)
+	}
+	if _, err := adapter.SubmitTransfer(ctx, node, rpc.Transfer{Sender: key.Address(), Receiver: "0xreceiver", Value: 1, Nonce: 1, Raw: signed.Raw()}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = adapter.FindTransaction(ctx, node, key.Address(), 1, signed.Hash()); err != nil || st.ID != "0x"+signed.Hash() {
+		t.Errorf("signed transaction: found %s (err %v), want 0x%s", st.ID, err, signed.Hash())
+	}
+}
+
+// ethStub answers single Ethereum JSON-RPC calls from results, keyed by
+// method.
+func ethStub(t *testing.T, results map[string]string) model.NodeInfo {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID     uint64 `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, ok := results[req.Method]
+		if !ok {
+			t.Errorf("unexpected call to %s", req.Method)
+			result = "null"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": json.RawMessage(result)})
+	}))
+	t.Cleanup(srv.Close)
+	return model.NodeInfo{URL: srv.URL, Address: "0xsender"}
+}
+
+func TestEthereumFailedReceipt(t *testing.T) {
+	node := ethStub(t, map[string]string{
+		"eth_getTransactionReceipt": `{"blockNumber":"0x5","status":"0x0"}`,
+		// The block is finalized, but a failed transaction stays failed
+		"eth_getBlockByNumber": `{"number":"0x5","timestamp":"0x64"}`,
+	})
+	client := rpc.NewClient(rpc.ClientConfig{})
+	defer client.CloseIdleConnections()
+	st, err := rpc.NewEthereumAdapter(client, 0).GetStatus(context.Background(), node, "0xfailed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != rpc.StatusFailed || st.ExecutedAt != 100 {
+		t.Errorf("status %v executed at %d, want failed at 100", st.Status, st.ExecutedAt)
+	}
+}
+
+func TestEthereumQuantityDecoding(t *testing.T) {
+	client := rpc.NewClient(rpc.ClientConfig{})
+	defer client.CloseIdleConnections()
+	ctx := context.Background()
+
+	node := ethStub(t, map[string]string{
+		"eth_getTransactionCount": `"0x1f"`,
+		"eth_getBalance":          `"0x152d02c7e14af6800000"`,
+	})
+	adapter := rpc.NewEthereumAdapter(client, 0)
+	if next, err := adapter.GetNonce(ctx, node, node.Address); err != nil || next != 31 {
+		t.Errorf("GetNonce = %d (err %v), want 31", next, err)
+	}
+	// 100000 ether in wei, beyond uint64
+	balance, err := adapter.GetBalance(ctx, node, node.Address)
+	if err != nil || balance.String() != "100000000000000000000000" {
+		t.Errorf("GetBalance = %v (err %v), want 100000000000000000000000", balance, err)
+	}
+
+	for _, result := range []string{`"31"`, `"0xzz"`, `"0x10000000000000000"`} {
+		node := ethStub(t, map[string]string{"eth_getTransactionCount": result, "eth_getBalance": result})
+		if _, err := adapter.GetNonce(ctx, node, node.Address); !errors.Is(err, rpc.ErrProtocol) {
+			t.Errorf("GetNonce of %s: err = %v, want ErrProtocol", result, err)
+		}
+		if result == `"0x10000000000000000"` {
+			// Balances may exceed uint64
+			continue
+		}
+		if _, err := adapter.GetBalance(ctx, node, node.Address); !errors.Is(err, rpc.ErrProtocol) {
+			t.Errorf("GetBalance of %s: err = %v, want ErrProtocol", result, err)
+		}
+	}
+}
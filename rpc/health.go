@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"metrics/logger"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig controls when a node's circuit opens. Zero values use the
+// defaults from DefaultBreakerConfig.
+type BreakerConfig struct {
+	// Window is the number of most recent outcomes the failure rate is
+	// computed over.
+	Window int
+	// MinRequests is the number of outcomes needed before the circuit can
+	// open.
+	MinRequests int
+	// FailureRate opens the circuit when failures/outcomes reaches it.
+	FailureRate float64
+	// OpenTimeout is how long an open circuit rejects traffic before a
+	// half-open trial is allowed.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent trial requests allowed
+	// while half-open; the circuit closes once that many have succeeded.
+	HalfOpenRequests int
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:           20,
+		MinRequests:      5,
+		FailureRate:      0.5,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+func (cfg BreakerConfig) withDefaults() BreakerConfig {
+	def := DefaultBreakerConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = def.MinRequests
+	}
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = def.FailureRate
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = def.OpenTimeout
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = def.HalfOpenRequests
+	}
+	return cfg
+}
+
+// CircuitBreaker tracks the recent error rate of one node. Only failures that
+// say something about the node's health count: transport errors, timeouts and
+// 5xx/429 replies. Application errors such as "nonce too low" are successes
+// from the breaker's point of view.
+type CircuitBreaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu        sync.Mutex
+	state     BreakerState
+	outcomes  []bool // ring buffer, true = failure
+	next      int
+	count     int
+	failures  int
+	openedAt  time.Time
+	trials    int
+	successes int
+	// halfOpens counts the moves to half-open, so trial outcomes can be
+	// told from those of requests admitted before.
+	halfOpens uint64
+}
+
+func NewCircuitBreaker(name string, cfg BreakerConfig) *CircuitBreaker {
+	cfg = cfg.withDefaults()
+	return &CircuitBreaker{
+		name:     name,
+		cfg:      cfg,
+		outcomes: make([]bool, cfg.Window),
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// ready reports whether a request could be let through now, without
+// reserving a half-open trial.
+func (b *CircuitBreaker) ready(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return now.Sub(b.openedAt) >= b.cfg.OpenTimeout
+	case BreakerHalfOpen:
+		return b.trials < b.cfg.HalfOpenRequests
+	}
+	return true
+}
+
+// begin lets a request through, moving an expired open circuit to half-open
+// and reserving a trial slot. It returns the half-open period the request is
+// a trial in, or zero if the circuit is closed.
+func (b *CircuitBreaker) begin(now time.Time) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.transition(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		b.trials++
+		return b.halfOpens
+	}
+	return 0
+}
+
+// Record feeds the outcome of a request that was not a half-open trial.
+func (b *CircuitBreaker) Record(err error) {
+	b.record(err, 0)
+}
+
+// record feeds the outcome of a request let through by begin, which
+// returned trial. While half-open, only the outcomes of that period's
+// trials count: a request admitted before the circuit opened says nothing
+// about whether the node has recovered.
+func (b *CircuitBreaker) record(err error, trial uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	isTrial := b.state == BreakerHalfOpen && trial != 0 && trial == b.halfOpens
+	if isTrial && b.trials > 0 {
+		b.trials--
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	failed := isHealthFailure(err)
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if !isTrial {
+			return
+		}
+		if failed {
+			b.trip()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.reset()
+			b.transition(BreakerClosed)
+		}
+	case BreakerClosed:
+		b.push(failed)
+		if b.count >= b.cfg.MinRequests && float64(b.failures)/float64(b.count) >= b.cfg.FailureRate {
+			b.trip()
+		}
+	}
+}
+
+// RecordProbe feeds the outcome of a health probe. A successful probe lets an
+// open circuit move to half-open early; failed probes count like failed
+// requests.
+func (b *CircuitBreaker) RecordProbe(err error) {
+	b.mu.Lock()
+	if b.state == BreakerOpen && err == nil {
+		b.transition(BreakerHalfOpen)
+		b.mu.Unlock()
+		return
+	}
+	if b.state != BreakerClosed {
+		if b.state == BreakerHalfOpen && isHealthFailure(err) {
+			b.trip()
+		}
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+	b.Record(err)
+}
+
+func (b *CircuitBreaker) push(failed bool) {
+	if b.count == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % len(b.outcomes)
+}
+
+func (b *CircuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.reset()
+	b.transition(BreakerOpen)
+}
+
+func (b *CircuitBreaker) reset() {
+	b.next, b.count, b.failures, b.successes, b.trials = 0, 0, 0, 0, 0
+}
+
+func (b *CircuitBreaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	logger.Metrics.Printf("Circuit breaker for %s: %s -> %s", b.name, b.state, to)
+	b.state = to
+	if to == BreakerHalfOpen {
+		b.halfOpens++
+	}
+}
+
+func isHealthFailure(err error) bool {
+	return errors.Is(err, ErrTransport) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+}
+
+// StartHealthChecks probes every node in the pool each interval with a cheap
+// nonce lookup through adapter and feeds the result to its circuit breaker.
+// It runs until ctx is done.
+func (p *NodePool) StartHealthChecks(ctx context.Context, adapter ChainAdapter, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			var wg sync.WaitGroup
+			for _, n := range p.nodes {
+				wg.Add(1)
+				go func(n *poolNode) {
+					defer wg.Done()
+					probeCtx, cancel := context.WithTimeout(ctx, interval)
+					defer cancel()
+					_, err := adapter.GetNonce(probeCtx, n.info, n.info.Address)
+					if ctx.Err() != nil {
+						return
+					}
+					n.breaker.RecordProbe(err)
+				}(n)
+			}
+			wg.Wait()
+		}
+	}()
+}
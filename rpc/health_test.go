@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"metrics/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T) *NodePool {
+	t.Helper()
+	pool, err := NewNodePool([]model.NodeInfo{{URL: "http://node"}}, RoundRobin, BreakerConfig{
+		Window:           4,
+		MinRequests:      1,
+		FailureRate:      0.5,
+		OpenTimeout:      10 * time.Millisecond,
+		HalfOpenRequests: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func acquire(t *testing.T, pool *NodePool) *Lease {
+	t.Helper()
+	lease, err := pool.Acquire(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lease
+}
+
+func TestBreakerOpensAndCloses(t *testing.T) {
+	pool := newTestPool(t)
+	breaker := pool.nodes[0].breaker
+
+	acquire(t, pool).Release(&Error{Kind: ErrUnavailable})
+	if got := breaker.State(); got != BreakerOpen {
+		t.Fatalf("after a failure, state = %s, want open", got)
+	}
+	if _, err := pool.Acquire(nil); err != ErrNoNodeAvailable {
+		t.Fatalf("Acquire on an open circuit: %v, want ErrNoNodeAvailable", err)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	trial := acquire(t, pool)
+	if got := breaker.State(); got != BreakerHalfOpen {
+		t.Fatalf("after the open timeout, state = %s, want half-open", got)
+	}
+	if _, err := pool.Acquire(nil); err != ErrNoNodeAvailable {
+		t.Fatalf("Acquire beyond the half-open trials: %v, want ErrNoNodeAvailable", err)
+	}
+	trial.Release(nil)
+	if got := breaker.State(); got != BreakerClosed {
+		t.Errorf("after a successful trial, state = %s, want closed", got)
+	}
+}
+
+func TestBreakerIgnoresOutcomesFromBeforeHalfOpen(t *testing.T) {
+	pool := newTestPool(t)
+	breaker := pool.nodes[0].breaker
+
+	// Admitted while closed, finishing only once the circuit is half-open
+	stale := acquire(t, pool)
+	staleFailure := acquire(t, pool)
+	acquire(t, pool).Release(&Error{Kind: ErrTimeout})
+	if got := breaker.State(); got != BreakerOpen {
+		t.Fatalf("after a failure, state = %s, want open", got)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	trial := acquire(t, pool)
+	stale.Release(nil)
+	staleFailure.Release(&Error{Kind: ErrTimeout})
+	if got := breaker.State(); got != BreakerHalfOpen {
+		t.Fatalf("after outcomes of earlier requests, state = %s, want half-open", got)
+	}
+	trial.Release(nil)
+	if got := breaker.State(); got != BreakerClosed {
+		t.Errorf("after the trial succeeded, state = %s, want closed", got)
+	}
+}
+
+func TestBreakerIgnoresTrialsOfEarlierHalfOpen(t *testing.T) {
+	pool := newTestPool(t)
+	breaker := pool.nodes[0].breaker
+
+	acquire(t, pool).Release(&Error{Kind: ErrTimeout})
+	time.Sleep(15 * time.Millisecond)
+	earlier := acquire(t, pool)
+	// A failed probe reopens the circuit while the trial is in flight
+	breaker.RecordProbe(&Error{Kind: ErrTimeout})
+	if got := breaker.State(); got != BreakerOpen {
+		t.Fatalf("after a failed probe, state = %s, want open", got)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	trial := acquire(t, pool)
+	earlier.Release(nil)
+	if got := breaker.State(); got != BreakerHalfOpen {
+		t.Fatalf("after a trial of the earlier half-open period, state = %s, want half-open", got)
+	}
+	trial.Release(nil)
+	if got := breaker.State(); got != BreakerClosed {
+		t.Errorf("after the current trial, state = %s, want closed", got)
+	}
+}
+
+// A call interrupted by cancellation, even with a cause such as a signal,
+// says nothing about the node and may not have reached it.
+func TestCanceledCallIsNotANodeFailure(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	client := NewClient(ClientConfig{})
+	defer client.CloseIdleConnections()
+	pool := newTestPool(t)
+	breaker := pool.nodes[0].breaker
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(20*time.Millisecond, func() { cancel(errors.New("stopped by signal: interrupt")) })
+	lease := acquire(t, pool)
+	_, err := client.SendRequest(ctx, srv.URL, newRequest("xygle_getNodeStats", map[string]interface{}{}))
+	lease.Release(err)
+
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want ErrCanceled", err)
+	}
+	if IsRetryable(err) || IsAmbiguous(err) {
+		t.Errorf("IsRetryable = %t, IsAmbiguous = %t; want false, false", IsRetryable(err), IsAmbiguous(err))
+	}
+	if got := breaker.State(); got != BreakerClosed {
+		t.Errorf("after a canceled call, state = %s, want closed", got)
+	}
+}
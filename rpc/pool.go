@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"metrics/models"
+	"sync"
+	"time"
+)
+
+// Strategy selects how a NodePool spreads requests across its nodes.
+type Strategy string
+
+const (
+	RoundRobin       Strategy = "round_robin"
+	LeastOutstanding Strategy = "least_outstanding"
+	Weighted         Strategy = "weighted"
+)
+
+// ErrNoNodeAvailable is returned when no node in the pool can take a request.
+var ErrNoNodeAvailable = errors.New("no node available")
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "", RoundRobin:
+		return RoundRobin, nil
+	case LeastOutstanding, Weighted:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("unknown load balancing strategy %q", s)
+}
+
+type poolNode struct {
+	info          model.NodeInfo
+	breaker       *CircuitBreaker
+	weight        int
+	currentWeight int
+	outstanding   int
+}
+
+// NodePool hands out nodes for client-side load balancing. It is safe for
+// concurrent use.
+type NodePool struct {
+	strategy Strategy
+	mu       sync.Mutex
+	nodes    []*poolNode
+	next     int
+}
+
+// NewNodePool builds a pool with one circuit breaker per node, configured by
+// breaker. Nodes whose circuit is open are skipped.
+func NewNodePool(nodes []model.NodeInfo, strategy Strategy, breaker BreakerConfig) (*NodePool, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("node pool needs at least one node")
+	}
+	if _, err := ParseStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+
+	p := &NodePool{strategy: strategy}
+	for _, n := range nodes {
+		weight := n.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		p.nodes = append(p.nodes, &poolNode{
+			info:    n,
+			breaker: NewCircuitBreaker(n.URL, breaker),
+			weight:  weight,
+		})
+	}
+	return p, nil
+}
+
+// Nodes returns every node in the pool.
+func (p *NodePool) Nodes() []model.NodeInfo {
+	nodes := make([]model.NodeInfo, len(p.nodes))
+	for i, n := range p.nodes {
+		nodes[i] = n.info
+	}
+	return nodes
+}
+
+func (p *NodePool) Strategy() Strategy {
+	return p.strategy
+}
+
+// BreakerStates returns the circuit state of every node, keyed by URL.
+func (p *NodePool) BreakerStates() map[string]BreakerState {
+	states := make(map[string]BreakerState, len(p.nodes))
+	for _, n := range p.nodes {
+		states[n.info.URL] = n.breaker.State()
+	}
+	return states
+}
+
+// Lease is a node checked out of the pool for one request. Release must be
+// called with the request's error once it has finished.
+type Lease struct {
+	Node model.NodeInfo
+	pool *NodePool
+	pn   *poolNode
+	// trial is the half-open period the request is a trial in, zero if
+	// the circuit was closed when it was admitted.
+	trial uint64
+	once  sync.Once
+}
+
+func (l *Lease) Release(err error) {
+	l.once.Do(func() {
+		l.pn.breaker.record(err, l.trial)
+		l.pool.mu.Lock()
+		l.pn.outstanding--
+		l.pool.mu.Unlock()
+	})
+}
+
+// Acquire picks a node according to the pool strategy, skipping nodes whose
+// circuit is open. If accept is not nil only nodes it returns true for are
+// considered.
+func (p *NodePool) Acquire(accept func(model.NodeInfo) bool) (*Lease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var candidates []*poolNode
+	for i := range p.nodes {
+		// Start from p.next so ties rotate between nodes.
+		n := p.nodes[(p.next+i)%len(p.nodes)]
+		if (accept == nil || accept(n.info)) && n.breaker.ready(now) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoNodeAvailable
+	}
+
+	var picked *poolNode
+	switch p.strategy {
+	case LeastOutstanding:
+		for _, n := range candidates {
+			if picked == nil || n.outstanding < picked.outstanding {
+				picked = n
+			}
+		}
+	case Weighted:
+		// Smooth weighted round-robin: spreads picks evenly in proportion
+		// to weight instead of bursting on the heaviest node.
+		total := 0
+		for _, n := range candidates {
+			n.currentWeight += n.weight
+			total += n.weight
+			if picked == nil || n.currentWeight > picked.currentWeight {
+				picked = n
+			}
+		}
+		picked.currentWeight -= total
+	default:
+		picked = candidates[0]
+	}
+
+	p.next = (p.next + 1) % len(p.nodes)
+	trial := picked.breaker.begin(now)
+	picked.outstanding++
+	return &Lease{Node: picked.info, pool: p, pn: picked, trial: trial}, nil
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"metrics/models"
+)
+
+// GetBalance
+func (c *Client) GetBalance(ctx context.Context, node model.NodeInfo, address string) (model.Balance, error) {
+	req := newRequest("xygle_getBalance", map[string]interface{}{"address": address})
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return model.Balance{}, err
+	}
+
+	var result model.Balance
+	if err := decodeResult(req, rpcResp, &result); err != nil {
+		return model.Balance{}, err
+	}
+	if result.Address == "" {
+		result.Address = address
+	}
+	return result, nil
+}
+
+// GetTransactions returns one page of the transactions sent or received by
+// address, newest first. Pass the NextCursor of the previous page to
+// continue; an empty cursor starts from the newest, and a zero limit uses
+// the node's default page size.
+func (c *Client) GetTransactions(ctx context.Context, node model.NodeInfo, address, cursor string, limit int) (model.TransactionPage, error) {
+	params := map[string]interface{}{"address": address}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	if limit > 0 {
+		params["limit"] = limit
+	}
+	req := newRequest("xygle_getTransactions", params)
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return model.TransactionPage{}, err
+	}
+
+	var page model.TransactionPage
+	if err := decodeResult(req, rpcResp, &page); err != nil {
+		return model.TransactionPage{}, err
+	}
+	for i, tx := range page.Transactions {
+		if tx.ID == "" {
+			page.Transactions[i].ID = tx.TransactionID
+		}
+	}
+	return page, nil
+}
+
+// GetAccountActivity returns up to limit of the most recent history entries
+// of address; a zero limit uses the node's default.
+func (c *Client) GetAccountActivity(ctx context.Context, node model.NodeInfo, address string, limit int) ([]model.AccountActivity, error) {
+	params := map[string]interface{}{"address": address}
+	if limit > 0 {
+		params["limit"] = limit
+	}
+	req := newRequest("xygle_getAccountActivity", params)
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		// An account without history may come back as null
+		if errors.Is(err, ErrEmptyResult) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var activity []model.AccountActivity
+	if err := decodeResult(req, rpcResp, &activity); err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// GetNodeStats
+func (c *Client) GetNodeStats(ctx context.Context, node model.NodeInfo) (model.NodeStats, error) {
+	req := newRequest("xygle_getNodeStats", map[string]interface{}{})
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return model.NodeStats{}, err
+	}
+
+	var stats model.NodeStats
+	if err := decodeResult(req, rpcResp, &stats); err != nil {
+		return model.NodeStats{}, err
+	}
+	return stats, nil
+}
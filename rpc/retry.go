@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryStrategy selects how the delay between attempts grows.
+type RetryStrategy string
+
+const (
+	// Exponential multiplies the delay by Multiplier after every attempt
+	// and waits a random time up to it ("full jitter").
+	Exponential RetryStrategy = "exponential"
+	// DecorrelatedJitter waits a random time between BaseDelay and three
+	// times the previous wait.
+	DecorrelatedJitter RetryStrategy = "decorrelated_jitter"
+	// ConstantBackoff always waits BaseDelay.
+	ConstantBackoff RetryStrategy = "constant"
+)
+
+// ParseRetryStrategy validates a retry strategy name; empty means
+// Exponential.
+func ParseRetryStrategy(s string) (RetryStrategy, error) {
+	switch RetryStrategy(s) {
+	case "":
+		return Exponential, nil
+	case Exponential, DecorrelatedJitter, ConstantBackoff:
+		return RetryStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown retry strategy %q (want exponential, decorrelated_jitter or constant)", s)
+}
+
+// Error classes that a RetryPolicy can override, as returned by ErrorClass.
+const (
+	ClassRateLimited = "rate_limited"
+	ClassUnavailable = "unavailable"
+	ClassTimeout     = "timeout"
+	ClassTransport   = "transport"
+	ClassNoNode      = "no_node"
+	ClassOther       = "other"
+)
+
+var errorClasses = []string{ClassRateLimited, ClassUnavailable, ClassTimeout, ClassTransport, ClassNoNode, ClassOther}
+
+// ErrorClass names the kind of failure err is, for per-class retry
+// settings: rate_limited (HTTP 429), unavailable (other 5xx replies),
+// timeout, transport, no_node (every circuit open) or other.
+func ErrorClass(err error) string {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr) && rpcErr.HTTPStatus == http.StatusTooManyRequests:
+		return ClassRateLimited
+	case errors.Is(err, ErrUnavailable):
+		return ClassUnavailable
+	case errors.Is(err, ErrTimeout):
+		return ClassTimeout
+	case errors.Is(err, ErrTransport):
+		return ClassTransport
+	case errors.Is(err, ErrNoNodeAvailable):
+		return ClassNoNode
+	}
+	return ClassOther
+}
+
+// RetryPolicy decides how often and how long apart a failed request is
+// retried. Zero values use the defaults from DefaultRetryPolicy. Whether an
+// error is worth retrying at all is up to the caller (see IsRetryable).
+type RetryPolicy struct {
+	Strategy RetryStrategy
+	// MaxAttempts bounds the attempts, including the first one.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps every wait except one a node asks for with
+	// Retry-After.
+	MaxDelay   time.Duration
+	Multiplier float64
+	// MaxElapsed gives up once another wait would take the request past
+	// this long since its first attempt.
+	MaxElapsed time.Duration
+	// Overrides replaces settings for errors of a class (see ErrorClass).
+	// Zero fields of an override are taken from the policy; MaxAttempts 1
+	// stops retrying that class.
+	Overrides map[string]RetryPolicy
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Strategy:    Exponential,
+		MaxAttempts: 5,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Multiplier:  2,
+		MaxElapsed:  30 * time.Second,
+	}
+}
+
+// Validate reports settings that cannot be used.
+func (p RetryPolicy) Validate() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	for class, o := range p.Overrides {
+		if !knownClass(class) {
+			return fmt.Errorf("retry override for unknown error class %q (want %s)", class, strings.Join(errorClasses, ", "))
+		}
+		if err := o.validate(); err != nil {
+			return fmt.Errorf("retry override for %s: %v", class, err)
+		}
+	}
+	return nil
+}
+
+func (p RetryPolicy) validate() error {
+	if _, err := ParseRetryStrategy(string(p.Strategy)); err != nil {
+		return err
+	}
+	switch {
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("max attempts must not be negative")
+	case p.BaseDelay < 0 || p.MaxDelay < 0 || p.MaxElapsed < 0:
+		return fmt.Errorf("retry delays must not be negative")
+	case p.Multiplier != 0 && p.Multiplier < 1:
+		return fmt.Errorf("retry multiplier must be at least 1, got %v", p.Multiplier)
+	}
+	return nil
+}
+
+func knownClass(class string) bool {
+	for _, c := range errorClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// withDefaults fills the zero fields of p from def.
+func (p RetryPolicy) withDefaults(def RetryPolicy) RetryPolicy {
+	if p.Strategy == "" {
+		p.Strategy = def.Strategy
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = def.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = def.MaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = def.Multiplier
+	}
+	if p.MaxElapsed <= 0 {
+		p.MaxElapsed = def.MaxElapsed
+	}
+	return p
+}
+
+// String describes the policy for logs.
+func (p RetryPolicy) String() string {
+	p = p.withDefaults(DefaultRetryPolicy())
+	s := fmt.Sprintf("%s, %d attempts, delay %v to %v, at most %v", p.Strategy, p.MaxAttempts, p.BaseDelay, p.MaxDelay, p.MaxElapsed)
+	var classes []string
+	for class := range p.Overrides {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		o := p.Overrides[class].withDefaults(p)
+		s += fmt.Sprintf("; %s: %s, %d attempts, delay %v to %v", class, o.Strategy, o.MaxAttempts, o.BaseDelay, o.MaxDelay)
+	}
+	return s
+}
+
+// Start begins the retries of one request.
+func (p RetryPolicy) Start() *Backoff {
+	return &Backoff{policy: p.withDefaults(DefaultRetryPolicy()), start: time.Now()}
+}
+
+// Backoff paces the retries of one request. It is not safe for concurrent
+// use.
+type Backoff struct {
+	policy  RetryPolicy
+	start   time.Time
+	failed  int
+	retries int
+	prev    time.Duration
+	// rng, if set, replaces the global source of jitter.
+	rng *rand.Rand
+}
+
+// Next records a failed attempt with err and returns how long to wait
+// before the next one, or false if the policy allows no more. A
+// Retry-After from the node is waited out in full.
+func (b *Backoff) Next(err error) (time.Duration, bool) {
+	b.failed++
+	p := b.policy
+	if o, ok := p.Overrides[ErrorClass(err)]; ok {
+		p = o.withDefaults(p)
+	}
+	if b.failed >= p.MaxAttempts {
+		return 0, false
+	}
+
+	var delay time.Duration
+	switch p.Strategy {
+	case ConstantBackoff:
+		delay = p.BaseDelay
+	case DecorrelatedJitter:
+		prev := b.prev
+		if prev < p.BaseDelay {
+			prev = p.BaseDelay
+		}
+		delay = p.BaseDelay + b.randDuration(3*prev-p.BaseDelay)
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	default:
+		ceiling := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(b.failed-1))
+		delay = b.randDuration(time.Duration(math.Min(ceiling, float64(p.MaxDelay))))
+	}
+	if after := RetryAfter(err); after > delay {
+		delay = after
+	}
+	if time.Since(b.start)+delay > p.MaxElapsed {
+		return 0, false
+	}
+	b.prev = delay
+	b.retries++
+	return delay, true
+}
+
+// Retries is the number of retries Next has allowed.
+func (b *Backoff) Retries() int {
+	return b.retries
+}
+
+// randDuration returns a random wait from zero to max inclusive.
+func (b *Backoff) randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	if b.rng != nil {
+		return time.Duration(b.rng.Int63n(int64(max) + 1))
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// RetryAfter returns the wait a node asked for with a Retry-After header on
+// the reply that caused err, or zero.
+func RetryAfter(err error) time.Duration {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an
+// HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// seeded starts a backoff for p whose jitter comes from seed.
+func seeded(p RetryPolicy, seed int64) *Backoff {
+	b := p.Start()
+	b.rng = rand.New(rand.NewSource(seed))
+	return b
+}
+
+// delays calls Next with err until the backoff gives up.
+func delays(b *Backoff, err error) []time.Duration {
+	var out []time.Duration
+	for {
+		d, ok := b.Next(err)
+		if !ok {
+			return out
+		}
+		out = append(out, d)
+	}
+}
+
+var errUnavailable = &Error{Kind: ErrUnavailable, HTTPStatus: http.StatusServiceUnavailable}
+
+func TestExponentialBackoff(t *testing.T) {
+	p := RetryPolicy{
+		Strategy:    Exponential,
+		MaxAttempts: 8,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Multiplier:  2,
+		MaxElapsed:  time.Hour,
+	}
+	ceilings := []time.Duration{100, 200, 400, 800, 1000, 1000, 1000}
+
+	first := delays(seeded(p, 1), errUnavailable)
+	if len(first) != len(ceilings) {
+		t.Fatalf("%d retries, want %d", len(first), len(ceilings))
+	}
+	means := make([]time.Duration, len(ceilings))
+	const runs = 1000
+	for seed := int64(1); seed <= runs; seed++ {
+		for i, d := range delays(seeded(p, seed), errUnavailable) {
+			if d < 0 || d > ceilings[i]*time.Millisecond {
+				t.Fatalf("seed %d: retry %d waits %v, want 0 to %v", seed, i+1, d, ceilings[i]*time.Millisecond)
+			}
+			means[i] += d / runs
+		}
+	}
+	// Full jitter averages half the ceiling, which doubles up to MaxDelay
+	for i, mean := range means {
+		want := ceilings[i] * time.Millisecond / 2
+		if mean < want*9/10 || mean > want*11/10 {
+			t.Errorf("retry %d waits %v on average, want about %v", i+1, mean, want)
+		}
+	}
+
+	// The same seed gives the same delays
+	again := delays(seeded(p, 1), errUnavailable)
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("seed 1 gave %v, then %v", first, again)
+		}
+	}
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	p := RetryPolicy{
+		Strategy:    DecorrelatedJitter,
+		MaxAttempts: 20,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		MaxElapsed:  time.Hour,
+	}
+	var capped bool
+	for seed := int64(1); seed <= 100; seed++ {
+		prev := p.BaseDelay
+		for i, d := range delays(seeded(p, seed), errUnavailable) {
+			upper := 3 * prev
+			if upper > p.MaxDelay {
+				upper = p.MaxDelay
+			}
+			if d < p.BaseDelay || d > upper {
+				t.Fatalf("seed %d: retry %d waits %v, want %v to %v", seed, i+1, d, p.BaseDelay, upper)
+			}
+			capped = capped || d == p.MaxDelay
+			prev = d
+		}
+	}
+	if !capped {
+		t.Error("no delay reached MaxDelay")
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	p := RetryPolicy{Strategy: ConstantBackoff, MaxAttempts: 4, BaseDelay: 250 * time.Millisecond, MaxElapsed: time.Hour}
+	b := seeded(p, 1)
+	got := delays(b, errUnavailable)
+	if len(got) != 3 {
+		t.Fatalf("%d retries, want 3", len(got))
+	}
+	for i, d := range got {
+		if d != p.BaseDelay {
+			t.Errorf("retry %d waits %v, want %v", i+1, d, p.BaseDelay)
+		}
+	}
+	if b.Retries() != 3 {
+		t.Errorf("Retries = %d, want 3", b.Retries())
+	}
+}
+
+func TestBackoffMaxElapsed(t *testing.T) {
+	p := RetryPolicy{Strategy: ConstantBackoff, MaxAttempts: 100, BaseDelay: 100 * time.Millisecond, MaxElapsed: time.Second}
+
+	b := seeded(p, 1)
+	b.start = time.Now().Add(-800 * time.Millisecond)
+	if d, ok := b.Next(errUnavailable); !ok || d != p.BaseDelay {
+		t.Fatalf("with 200ms left: Next = %v, %v; want %v, true", d, ok, p.BaseDelay)
+	}
+	b.start = time.Now().Add(-950 * time.Millisecond)
+	if _, ok := b.Next(errUnavailable); ok {
+		t.Error("with 50ms left, a 100ms wait was allowed")
+	}
+
+	// A Retry-After beyond the budget ends the retries too
+	b = seeded(p, 1)
+	if _, ok := b.Next(&Error{Kind: ErrUnavailable, RetryAfter: 2 * time.Second}); ok {
+		t.Error("a Retry-After of 2s was allowed with a budget of 1s")
+	}
+}
+
+func TestBackoffOverrides(t *testing.T) {
+	p := RetryPolicy{
+		Strategy:    ConstantBackoff,
+		MaxAttempts: 5,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		MaxElapsed:  time.Hour,
+		Overrides: map[string]RetryPolicy{
+			ClassRateLimited: {BaseDelay: 3 * time.Second},
+			ClassTimeout:     {MaxAttempts: 1},
+			ClassTransport:   {MaxAttempts: 2},
+		},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	rateLimited := &Error{Kind: ErrUnavailable, HTTPStatus: http.StatusTooManyRequests}
+	timeout := &Error{Kind: ErrTimeout}
+	transport := &Error{Kind: ErrTransport}
+
+	for _, tc := range []struct {
+		err     error
+		class   string
+		retries int
+		delay   time.Duration
+	}{
+		// MaxDelay is raised to the override's BaseDelay
+		{rateLimited, ClassRateLimited, 4, 3 * time.Second},
+		{timeout, ClassTimeout, 0, 0},
+		{transport, ClassTransport, 1, 100 * time.Millisecond},
+		{errUnavailable, ClassUnavailable, 4, 100 * time.Millisecond},
+	} {
+		if got := ErrorClass(tc.err); got != tc.class {
+			t.Errorf("ErrorClass(%v) = %s, want %s", tc.err, got, tc.class)
+		}
+		got := delays(seeded(p, 1), tc.err)
+		if len(got) != tc.retries {
+			t.Errorf("%s: %d retries, want %d", tc.class, len(got), tc.retries)
+			continue
+		}
+		for _, d := range got {
+			if d != tc.delay {
+				t.Errorf("%s: waits %v, want %v", tc.class, d, tc.delay)
+			}
+		}
+	}
+
+	// Attempts count across classes: a transport error as the third
+	// failure is over its limit of two
+	b := seeded(p, 1)
+	for i := 0; i < 2; i++ {
+		if _, ok := b.Next(errUnavailable); !ok {
+			t.Fatal("unavailable error not retried")
+		}
+	}
+	if _, ok := b.Next(transport); ok {
+		t.Error("transport error retried after its attempts were used up")
+	}
+
+	for name, bad := range map[string]RetryPolicy{
+		"unknown class":     {Overrides: map[string]RetryPolicy{"teapot": {}}},
+		"invalid override":  {Overrides: map[string]RetryPolicy{ClassTimeout: {Multiplier: 0.5}}},
+		"unknown strategy":  {Strategy: "linear"},
+		"negative attempts": {MaxAttempts: -1},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, bad)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":      0,
+		"3":     3 * time.Second,
+		" 120 ": 2 * time.Minute,
+		"-1":    0,
+		"soon":  0,
+		"1.5":   0,
+		"0":     0,
+	} {
+		if got := parseRetryAfter(header); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+
+	// HTTP dates have a resolution of one second
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 90s", future, got)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(past); got != 0 {
+		t.Errorf("parseRetryAfter(%q) = %v, want 0", past, got)
+	}
+}
+
+func TestRetryAfterTakesPrecedence(t *testing.T) {
+	p := RetryPolicy{Strategy: ConstantBackoff, MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 500 * time.Millisecond, MaxElapsed: time.Hour}
+
+	// Waited out in full, beyond MaxDelay
+	if d, ok := seeded(p, 1).Next(&Error{Kind: ErrUnavailable, RetryAfter: 2 * time.Second}); !ok || d != 2*time.Second {
+		t.Errorf("Retry-After 2s: Next = %v, %v; want 2s, true", d, ok)
+	}
+	// Shorter than the computed delay, so the computed delay stands
+	if d, ok := seeded(p, 1).Next(&Error{Kind: ErrUnavailable, RetryAfter: 10 * time.Millisecond}); !ok || d != p.BaseDelay {
+		t.Errorf("Retry-After 10ms: Next = %v, %v; want %v, true", d, ok, p.BaseDelay)
+	}
+
+	// Both header forms reach the error from a node's reply
+	for _, header := range []string{"2", time.Now().Add(3 * time.Second).UTC().Format(http.TimeFormat)} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", header)
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}))
+		client := NewClient(ClientConfig{})
+		_, err := client.SendRequest(context.Background(), srv.URL, newRequest("test_call", nil))
+		client.CloseIdleConnections()
+		srv.Close()
+
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) || ErrorClass(err) != ClassRateLimited {
+			t.Fatalf("Retry-After %q: err = %v, want a rate-limited *Error", header, err)
+		}
+		if rpcErr.RetryAfter < time.Second || rpcErr.RetryAfter > 3*time.Second {
+			t.Errorf("Retry-After %q: RetryAfter = %v, want 1s to 3s", header, rpcErr.RetryAfter)
+		}
+		if d, ok := seeded(p, 1).Next(err); !ok || d != rpcErr.RetryAfter {
+			t.Errorf("Retry-After %q: Next = %v, %v; want %v, true", header, d, ok, rpcErr.RetryAfter)
+		}
+	}
+}
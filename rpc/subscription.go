@@ -0,0 +1,333 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metrics/logger"
+	"metrics/models"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Subscription method names used by the xygle WebSocket endpoint.
+const (
+	subscribeMethod    = "xygle_subscribe"
+	unsubscribeMethod  = "xygle_unsubscribe"
+	notificationMethod = "xygle_subscription"
+
+	TopicTransactionStatus = "transactionStatus"
+
+	maxOrphanSubscriptions = 16
+	maxOrphanEvents        = 1024
+	// orphanTTL is how long notifications for an unknown subscription ID
+	// are kept before a new ID may take their place.
+	orphanTTL = 30 * time.Second
+)
+
+// ErrClosed is returned for calls on a WebSocket client whose connection has
+// gone away.
+var ErrClosed = errors.New("websocket connection closed")
+
+// wsMessage covers both responses and subscription notifications.
+type wsMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *model.RPCError `json:"error,omitempty"`
+}
+
+// SubscriptionNotification is the params object of a notification.
+type SubscriptionNotification struct {
+	Subscription string          `json:"subscription"`
+	Result       json.RawMessage `json:"result"`
+}
+
+// WSClient is a JSON-RPC client over one WebSocket connection. Calls are
+// multiplexed by request ID and notifications are routed to subscriptions.
+type WSClient struct {
+	conn *WSConn
+
+	mu      sync.Mutex
+	pending map[uint64]chan model.ResponseFromRPC
+	subs    map[string]chan json.RawMessage
+	// orphans holds notifications that arrive before Subscribe has
+	// registered their subscription ID.
+	orphans map[string]*orphanEvents
+	err     error
+
+	done chan struct{}
+}
+
+// DialWS connects to a node's WebSocket JSON-RPC endpoint. Use
+// Client.DialWS for nodes that need credentials or TLS settings.
+func DialWS(ctx context.Context, url string) (*WSClient, error) {
+	return dialWS(ctx, url, nil, nil)
+}
+
+func dialWS(ctx context.Context, url string, tlsConfig *tls.Config, header http.Header) (*WSClient, error) {
+	conn, err := DialWebSocket(ctx, url, tlsConfig, header)
+	if err != nil {
+		return nil, &Error{Kind: ErrTransport, Method: "websocket", Err: err}
+	}
+
+	c := &WSClient{
+		conn:    conn,
+		pending: make(map[uint64]chan model.ResponseFromRPC),
+		subs:    make(map[string]chan json.RawMessage),
+		orphans: make(map[string]*orphanEvents),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Call sends a request and waits for its response.
+func (c *WSClient) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	req := newRequest(method, params)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	respCh := make(chan model.ResponseFromRPC, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, &Error{Kind: ErrTransport, Method: method, RequestID: req.ID, Err: c.err}
+	}
+	c.pending[req.ID] = respCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.conn.WriteMessage(body); err != nil {
+		return nil, transportError(ctx, req, err)
+	}
+
+	select {
+	case resp, ok := <-respCh:
+		if !ok {
+			return nil, &Error{Kind: ErrTransport, Method: method, RequestID: req.ID, Err: ErrClosed}
+		}
+		if err := checkResponse(req, resp); err != nil {
+			return nil, err
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return nil, transportError(ctx, req, ctx.Err())
+	}
+}
+
+// Subscription delivers the raw result of every notification for one
+// subscription ID. Events is closed when the subscription or connection ends.
+type Subscription struct {
+	ID     string
+	client *WSClient
+	events chan json.RawMessage
+}
+
+func (s *Subscription) Events() <-chan json.RawMessage {
+	return s.events
+}
+
+// Unsubscribe cancels the subscription on the node and closes Events.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	s.client.mu.Lock()
+	ch, ok := s.client.subs[s.ID]
+	delete(s.client.subs, s.ID)
+	s.client.mu.Unlock()
+	if ok {
+		close(ch)
+	}
+
+	_, err := s.client.Call(ctx, unsubscribeMethod, map[string]interface{}{"subscription": s.ID})
+	return err
+}
+
+// Subscribe registers for notifications on topic.
+func (c *WSClient) Subscribe(ctx context.Context, topic string, params map[string]interface{}) (*Subscription, error) {
+	p := map[string]interface{}{"topic": topic}
+	for k, v := range params {
+		p[k] = v
+	}
+
+	result, err := c.Call(ctx, subscribeMethod, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	if err := json.Unmarshal(result, &id); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal subscription ID: %v", err)
+	}
+
+	sub := &Subscription{ID: id, client: c, events: make(chan json.RawMessage, 1024)}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, &Error{Kind: ErrTransport, Method: subscribeMethod, Err: c.err}
+	}
+	c.subs[id] = sub.events
+	if o := c.orphans[id]; o != nil {
+		for _, raw := range o.events {
+			sub.events <- raw
+		}
+	}
+	delete(c.orphans, id)
+	c.mu.Unlock()
+	return sub, nil
+}
+
+// SubscribeTransactions streams status updates for transactions sent by
+// address (all transactions if empty), decoded as model.TransactionResult.
+// The returned channel closes with the subscription or when ctx is done.
+func (c *WSClient) SubscribeTransactions(ctx context.Context, address string) (*Subscription, <-chan model.TransactionResult, error) {
+	var params map[string]interface{}
+	if address != "" {
+		params = map[string]interface{}{"address": address}
+	}
+	sub, err := c.Subscribe(ctx, TopicTransactionStatus, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make(chan model.TransactionResult, cap(sub.events))
+	go func() {
+		defer close(out)
+		for raw := range sub.events {
+			detail, err := decodeTransactionDetails(raw)
+			if err != nil {
+				logger.Error.Printf("subscription %s: %v", sub.ID, err)
+				continue
+			}
+			select {
+			case out <- detail:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sub, out, nil
+}
+
+// Done is closed when the connection has been lost or closed.
+func (c *WSClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that ended the connection, if any.
+func (c *WSClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *WSClient) Close() error {
+	return c.conn.Close()
+}
+
+// orphanEvents are the notifications of a subscription ID Subscribe has
+// not registered yet, and when the first of them arrived.
+type orphanEvents struct {
+	events []json.RawMessage
+	first  time.Time
+}
+
+// bufferOrphan keeps raw for the subscription id until Subscribe registers
+// it. A new ID is only taken on while fewer than maxOrphanSubscriptions are
+// buffered, after dropping those older than orphanTTL. c.mu must be held.
+func (c *WSClient) bufferOrphan(id string, raw json.RawMessage, now time.Time) {
+	o := c.orphans[id]
+	if o == nil {
+		if len(c.orphans) >= maxOrphanSubscriptions {
+			for stale, old := range c.orphans {
+				if now.Sub(old.first) > orphanTTL {
+					delete(c.orphans, stale)
+				}
+			}
+		}
+		if len(c.orphans) >= maxOrphanSubscriptions {
+			return
+		}
+		o = &orphanEvents{first: now}
+		c.orphans[id] = o
+	}
+	if len(o.events) < maxOrphanEvents {
+		o.events = append(o.events, raw)
+	}
+}
+
+func (c *WSClient) readLoop() {
+	var readErr error
+	for {
+		data, err := c.conn.ReadMessage()
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Error.Printf("websocket: failed to unmarshal message: %v; body: %s", err, string(data))
+			continue
+		}
+
+		if msg.Method == notificationMethod {
+			var n SubscriptionNotification
+			if err := json.Unmarshal(msg.Params, &n); err != nil {
+				logger.Error.Printf("websocket: failed to unmarshal notification: %v", err)
+				continue
+			}
+			c.mu.Lock()
+			ch, ok := c.subs[n.Subscription]
+			switch {
+			case ok:
+				select {
+				case ch <- n.Result:
+				default:
+					logger.Error.Printf("websocket: subscription %s is not keeping up, dropping event", n.Subscription)
+				}
+			default:
+				c.bufferOrphan(n.Subscription, n.Result, time.Now())
+			}
+			c.mu.Unlock()
+			continue
+		}
+
+		if msg.ID == nil {
+			logger.Error.Printf("websocket: ignoring message without ID: %s", string(data))
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		c.mu.Unlock()
+		if !ok {
+			logger.Error.Printf("websocket: ignoring response for unknown request ID %d", *msg.ID)
+			continue
+		}
+		ch <- model.ResponseFromRPC{JSONRPC: msg.JSONRPC, ID: msg.ID, Result: msg.Result, Error: msg.Error}
+	}
+
+	c.mu.Lock()
+	c.err = readErr
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	for id, ch := range c.subs {
+		close(ch)
+		delete(c.subs, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
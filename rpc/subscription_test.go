@@ -0,0 +1,144 @@
+package rpc_test
+
+import (
+	"context"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/rpctest"
+	"testing"
+	"time"
+)
+
+func newMockNode(t *testing.T) (*rpctest.Server, *rpc.Client) {
+	t.Helper()
+	srv := rpctest.NewServer(rpctest.Config{
+		ExecutionDelay: rpctest.Fixed(20 * time.Millisecond),
+		FinalityDelay:  rpctest.Fixed(20 * time.Millisecond),
+	})
+	t.Cleanup(srv.Close)
+	client := rpc.NewClient(rpc.ClientConfig{})
+	t.Cleanup(client.CloseIdleConnections)
+	return srv, client
+}
+
+func transfer(t *testing.T, adapter rpc.ChainAdapter, node model.NodeInfo, nonce uint64) string {
+	t.Helper()
+	txID, err := adapter.SubmitTransfer(context.Background(), node, rpc.Transfer{
+		Sender:   node.Address,
+		Receiver: "0xreceiver",
+		Value:    1,
+		Nonce:    nonce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txID
+}
+
+func TestSubscribeTransactions(t *testing.T) {
+	srv, client := newMockNode(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws, err := rpc.DialWS(ctx, srv.WSURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	sub, events, err := ws.SubscribeTransactions(ctx, srv.Node().Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another account's transactions are filtered out by the node
+	_, others, err := ws.SubscribeTransactions(ctx, "0xsomeoneelse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txID := transfer(t, rpc.NewXygleAdapter(client), srv.Node(), 1)
+	var executed, final bool
+	for !final {
+		select {
+		case ev := <-events:
+			if ev.ID != txID {
+				t.Fatalf("event for %s, want %s", ev.ID, txID)
+			}
+			executed = executed || ev.ExecutionStatus == "SUCCESS"
+			final = ev.IsFinal
+		case ev := <-others:
+			t.Fatalf("filtered subscription got event for %s", ev.ID)
+		case <-ctx.Done():
+			t.Fatalf("no final event (executed seen: %t)", executed)
+		}
+	}
+	if !executed {
+		t.Error("final event without execution")
+	}
+
+	// Calls share the connection with the notifications
+	if _, err := ws.Call(ctx, "xygle_getAccountState", map[string]string{"address": srv.Node().Address}); err != nil {
+		t.Errorf("call over websocket: %v", err)
+	}
+
+	if err := sub.Unsubscribe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Events still open after Unsubscribe")
+	}
+}
+
+func TestSubscriptionEndsWithConnection(t *testing.T) {
+	srv := rpctest.NewServer(rpctest.Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws, err := rpc.DialWS(ctx, srv.WSURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	sub, err := ws.Subscribe(ctx, rpc.TopicTransactionStatus, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	select {
+	case <-ws.Done():
+	case <-ctx.Done():
+		t.Fatal("Done not closed after the node went away")
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Events still open after the connection ended")
+	}
+	if _, err := ws.Call(ctx, "xygle_getAccountState", map[string]string{"address": "0x1"}); err == nil {
+		t.Error("call on a closed connection succeeded")
+	}
+}
+
+func TestAdapterSubscribeStatuses(t *testing.T) {
+	srv, client := newMockNode(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	adapter := rpc.NewXygleAdapter(client)
+
+	stream, err := adapter.SubscribeStatuses(ctx, srv.Node(), []string{srv.Node().Address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	txID := transfer(t, adapter, srv.Node(), 1)
+	want := []rpc.Status{rpc.StatusExecuted, rpc.StatusFinal}
+	for _, status := range want {
+		select {
+		case ev := <-stream.Events:
+			if ev.ID != txID || ev.Status != status {
+				t.Errorf("event %s %s, want %s %s", ev.ID, ev.Status, txID, status)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no %s event", status)
+		}
+	}
+}
@@ -1,84 +1,142 @@
-	package rpc
-
-	import (
-		"encoding/json"
-		"fmt"
-		"metrics/models"
-	)
-
-	
-	// GetAccountState
-	func GetAccountState(node model.NodeInfo, address string) (map[string]interface{}, error) {
-		req := model.RequestToRPC{
-			JSONRPC: "2.0",
-			ID:      1,
-			Method:  "xygle_getAccountState",
-			Params:  map[string]interface{}{"address": address},
-		}
+package rpc
 
-		rpcResp, err := SendRequestToRPC(node.URL, req)
-		if err != nil {
-			return nil, err
-		}
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metrics/models"
+)
 
-		var result map[string]interface{}
-		if err := json.Unmarshal(rpcResp.Result, &result); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal account state: %v", err)
-		}
-		return result, nil
+// GetAccountState
+func (c *Client) GetAccountState(ctx context.Context, node model.NodeInfo, address string) (model.AccountState, error) {
+	req := newRequest("xygle_getAccountState", map[string]interface{}{"address": address})
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return model.AccountState{}, err
 	}
 
-	// GetTransactionDetails
-	func GetTransactionDetails(node model.NodeInfo, txID string) (model.TransactionResult, error) {
-		req := model.RequestToRPC{
-			JSONRPC: "2.0",
-			ID:      1,
-			Method:  "xygle_getTransaction",
-			Params:  map[string]interface{}{"id": txID},
-		}
+	var result model.AccountState
+	if err := decodeResult(req, rpcResp, &result); err != nil {
+		return model.AccountState{}, err
+	}
+	return result, nil
+}
 
-		rpcResp, err := SendRequestToRPC(node.URL, req)
-		if err != nil {
-			return model.TransactionResult{}, err
+// decodeResult unmarshals the result of resp into v, reporting malformed
+// results as ErrProtocol.
+func decodeResult(req model.RequestToRPC, resp model.ResponseFromRPC, v interface{}) error {
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		return &Error{
+			Kind:      ErrProtocol,
+			Method:    req.Method,
+			RequestID: req.ID,
+			Err:       err,
 		}
+	}
+	return nil
+}
 
-		var result model.TransactionResult
-		if err := json.Unmarshal(rpcResp.Result, &result); err != nil {
-			return model.TransactionResult{}, fmt.Errorf("failed to unmarshal transaction details: %v", err)
-		}
+// GetTransactionDetails
+func (c *Client) GetTransactionDetails(ctx context.Context, node model.NodeInfo, txID string) (model.TransactionResult, error) {
+	req := newRequest("xygle_getTransaction", map[string]interface{}{"id": txID})
 
-		if result.ID == "" && result.TransactionID != "" {
-			result.ID = result.TransactionID
-		}
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return model.TransactionResult{}, notFoundIfEmpty(err)
+	}
+
+	return decodeTransactionDetails(rpcResp.Result)
+}
 
-		return result, nil
+// notFoundIfEmpty treats a null transaction lookup as ErrNotFound, which is
+// how the node reports a transaction it has not seen yet.
+func notFoundIfEmpty(err error) error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) && rpcErr.Kind == ErrEmptyResult {
+		notFound := *rpcErr
+		notFound.Kind = ErrNotFound
+		return &notFound
 	}
+	return err
+}
 
-	// TransferFund
-	func TransferFund(node model.NodeInfo, receiver string, value int, nonce int) (string, error) {
-		req := model.RequestToRPC{
-			JSONRPC: "2.0",
-			ID:      1,
-			Method:  "xygle_transferFund",
-			Params: map[string]interface{}{
-				"receiver": receiver,
-				"value":    value,
-				"nonce":    nonce,
-			},
-		}
-	
-		rpcResp, err := SendRequestToRPC(node.URL, req)
-		if err != nil {
-			return "", err
-		}
-	
-		var result struct {
-			Status        string `json:"status"`
-			TransactionID string `json:"transaction_id"`
-		}
-		if err := json.Unmarshal(rpcResp.Result, &result); err != nil {
-			return "", fmt.Errorf("failed to unmarshal transfer response: %v", err)
-		}
-	
-		return result.TransactionID, nil
+func decodeTransactionDetails(raw json.RawMessage) (model.TransactionResult, error) {
+	var result model.TransactionResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return model.TransactionResult{}, fmt.Errorf("failed to unmarshal transaction details: %v", err)
+	}
+
+	if result.ID == "" && result.TransactionID != "" {
+		result.ID = result.TransactionID
+	}
+
+	return result, nil
+}
+
+// TransferFund
+func (c *Client) TransferFund(ctx context.Context, node model.NodeInfo, receiver string, value uint64, nonce uint64) (string, error) {
+	req := newRequest("xygle_transferFund", TransferParams(receiver, value, nonce))
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Status        string `json:"status"`
+		TransactionID string `json:"transaction_id"`
+	}
+	if err := json.Unmarshal(rpcResp.Result, &result); err != nil {
+		return "", fmt.Errorf("failed to unmarshal transfer response: %v", err)
+	}
+
+	return result.TransactionID, nil
+}
+
+// TransferParams builds the params of xygle_transferFund.
+func TransferParams(receiver string, value uint64, nonce uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"receiver": receiver,
+		"value":    value,
+		"nonce":    nonce,
+	}
+}
+
+// RawTransactionParams builds the params of xygle_sendRawTransaction.
+func RawTransactionParams(raw []byte) map[string]interface{} {
+	return map[string]interface{}{"raw": "0x" + hex.EncodeToString(raw)}
+}
+
+// SendRawTransaction submits a transaction signed by the caller, such as
+// the output of signer.SignedTransaction.Raw, and returns its ID.
+func (c *Client) SendRawTransaction(ctx context.Context, node model.NodeInfo, raw []byte) (string, error) {
+	return c.SubmitTransaction(ctx, node, "xygle_sendRawTransaction", RawTransactionParams(raw))
+}
+
+// SubmitTransaction sends a submission whose params were built in advance,
+// for example by TransferParams or RawTransactionParams and stored as JSON,
+// and returns the transaction ID.
+func (c *Client) SubmitTransaction(ctx context.Context, node model.NodeInfo, method string, params interface{}) (string, error) {
+	req := newRequest(method, params)
+
+	rpcResp, err := c.SendRequest(ctx, node.URL, req)
+	if err != nil {
+		return "", err
+	}
+
+	// The node answers with the bare ID or with the transferFund shape
+	var txID string
+	if json.Unmarshal(rpcResp.Result, &txID) == nil {
+		return txID, nil
+	}
+	var result struct {
+		TransactionID string `json:"transaction_id"`
+	}
+	if err := decodeResult(req, rpcResp, &result); err != nil {
+		return "", err
 	}
+	return result.TransactionID, nil
+}
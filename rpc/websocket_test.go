@@ -0,0 +1,326 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"metrics/logger"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitDiscard()
+	os.Exit(m.Run())
+}
+
+// wsServer serves handle on every WebSocket connection and returns its
+// ws:// URL.
+func wsServer(t *testing.T, handle func(*WSConn)) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := AcceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *WSConn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := DialWebSocket(ctx, url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// rawFrame encodes a single frame, masked with a fixed key if mask is set.
+func rawFrame(fin bool, opcode byte, payload []byte, mask bool) []byte {
+	var b bytes.Buffer
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	b.WriteByte(first)
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b.WriteByte(maskBit | byte(n))
+	case n <= 0xFFFF:
+		b.WriteByte(maskBit | 126)
+		binary.Write(&b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(maskBit | 127)
+		binary.Write(&b, binary.BigEndian, uint64(n))
+	}
+	if !mask {
+		b.Write(payload)
+		return b.Bytes()
+	}
+	key := [4]byte{0x12, 0x34, 0x56, 0x78}
+	b.Write(key[:])
+	for i, c := range payload {
+		b.WriteByte(c ^ key[i%4])
+	}
+	return b.Bytes()
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	url := wsServer(t, func(conn *WSConn) {
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(msg)
+		}
+	})
+	conn := dial(t, url)
+
+	// Sizes around the 7-bit, 16-bit and 64-bit length encodings
+	for _, size := range []int{0, 5, 125, 126, 0xFFFF, 0x10000, 200000} {
+		msg := bytes.Repeat([]byte{'x'}, size)
+		if err := conn.WriteMessage(msg); err != nil {
+			t.Fatalf("write %d bytes: %v", size, err)
+		}
+		got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("echo of %d bytes came back as %d bytes", size, len(got))
+		}
+	}
+}
+
+func TestWebSocketClientMasksFrames(t *testing.T) {
+	headers := make(chan [2]byte, 1)
+	url := wsServer(t, func(conn *WSConn) {
+		var header [2]byte
+		io.ReadFull(conn.br, header[:])
+		headers <- header
+	})
+	conn := dial(t, url)
+
+	if err := conn.WriteMessage([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	header := <-headers
+	if header[0] != 0x80|wsOpText {
+		t.Errorf("first byte = %#x, want FIN and text opcode", header[0])
+	}
+	if header[1]&0x80 == 0 {
+		t.Error("client frame is not masked")
+	}
+	if header[1]&0x7F != 2 {
+		t.Errorf("payload length = %d, want 2", header[1]&0x7F)
+	}
+}
+
+func TestWebSocketFragmentedMessages(t *testing.T) {
+	received := make(chan string, 1)
+	url := wsServer(t, func(conn *WSConn) {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- string(msg)
+		// Reply in fragments, unmasked as from a server
+		conn.conn.Write(rawFrame(false, wsOpText, []byte("wor"), false))
+		conn.conn.Write(rawFrame(true, wsOpContinuation, []byte("ld"), false))
+		conn.ReadMessage()
+	})
+	conn := dial(t, url)
+
+	// A ping between the fragments is answered without breaking up the message
+	conn.conn.Write(rawFrame(false, wsOpText, []byte("hel"), true))
+	conn.conn.Write(rawFrame(true, wsOpPing, []byte("p"), true))
+	conn.conn.Write(rawFrame(true, wsOpContinuation, []byte("lo"), true))
+
+	if got := <-received; got != "hello" {
+		t.Errorf("server read %q, want %q", got, "hello")
+	}
+	fin, opcode, payload, err := conn.readFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fin || opcode != wsOpPong || string(payload) != "p" {
+		t.Errorf("got frame fin=%t opcode=%d payload=%q, want pong %q", fin, opcode, payload, "p")
+	}
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "world" {
+		t.Errorf("client read %q, want %q", got, "world")
+	}
+}
+
+func TestWebSocketAnswersPing(t *testing.T) {
+	pongs := make(chan string, 1)
+	url := wsServer(t, func(conn *WSConn) {
+		conn.writeFrame(wsOpPing, []byte("are you there"))
+		conn.WriteMessage([]byte("after ping"))
+		_, opcode, payload, err := conn.readFrame()
+		if err == nil && opcode == wsOpPong {
+			pongs <- string(payload)
+		}
+		close(pongs)
+	})
+	conn := dial(t, url)
+
+	msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "after ping" {
+		t.Errorf("ReadMessage() = %q, want the message after the ping", msg)
+	}
+	if pong := <-pongs; pong != "are you there" {
+		t.Errorf("pong payload = %q, want the ping's", pong)
+	}
+}
+
+func TestWebSocketCloseFromServer(t *testing.T) {
+	url := wsServer(t, func(conn *WSConn) {
+		conn.Close()
+	})
+	conn := dial(t, url)
+
+	if _, err := conn.ReadMessage(); err != io.EOF {
+		t.Fatalf("ReadMessage() error = %v, want io.EOF", err)
+	}
+	// The close frame has been answered, so nothing more may be written
+	if err := conn.WriteMessage([]byte("late")); err == nil {
+		t.Error("WriteMessage after close succeeded")
+	}
+	conn.Close()
+}
+
+func TestWebSocketCloseFromClient(t *testing.T) {
+	result := make(chan error, 1)
+	url := wsServer(t, func(conn *WSConn) {
+		_, err := conn.ReadMessage()
+		result <- err
+	})
+	conn := dial(t, url)
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != io.EOF {
+			t.Errorf("server ReadMessage() error = %v, want io.EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not see the close")
+	}
+}
+
+func TestWebSocketRejectsPlainRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AcceptWebSocket(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+// Notifications that arrive before the subscribe call returns are kept for
+// the subscription.
+func TestSubscribeKeepsEarlyNotifications(t *testing.T) {
+	url := wsServer(t, func(conn *WSConn) {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID uint64 `json:"id"`
+		}
+		json.Unmarshal(data, &req)
+		for i := 0; i < 3; i++ {
+			conn.WriteMessage([]byte(`{"jsonrpc":"2.0","method":"xygle_subscription","params":{"subscription":"0x1","result":` +
+				string(rune('0'+i)) + `}}`))
+		}
+		resp, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "0x1"})
+		conn.WriteMessage(resp)
+		conn.ReadMessage()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := DialWS(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sub, err := client.Subscribe(ctx, TopicTransactionStatus, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case raw := <-sub.Events():
+			if string(raw) != string(rune('0'+i)) {
+				t.Errorf("event %d = %s, want %d", i, raw, i)
+			}
+		case <-ctx.Done():
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+}
+
+func TestOrphanBufferingLimits(t *testing.T) {
+	c := &WSClient{orphans: make(map[string]*orphanEvents)}
+	start := time.Now()
+	c.bufferOrphan("0xkept", json.RawMessage("0"), start)
+	for i := 0; i < maxOrphanSubscriptions; i++ {
+		c.bufferOrphan(fmt.Sprintf("0xother%d", i), json.RawMessage("0"), start)
+	}
+	if len(c.orphans) != maxOrphanSubscriptions {
+		t.Fatalf("%d orphan IDs buffered, want %d", len(c.orphans), maxOrphanSubscriptions)
+	}
+
+	// An ID already buffered keeps its later notifications
+	c.bufferOrphan("0xkept", json.RawMessage("1"), start)
+	if got := len(c.orphans["0xkept"].events); got != 2 {
+		t.Errorf("buffered ID has %d events, want 2", got)
+	}
+
+	// Stale IDs make room for new ones
+	later := start.Add(orphanTTL + time.Second)
+	c.bufferOrphan("0xnew", json.RawMessage("0"), later)
+	if c.orphans["0xnew"] == nil {
+		t.Error("new ID not buffered after the others went stale")
+	}
+	if len(c.orphans) != 1 {
+		t.Errorf("%d orphan IDs left, want only the new one", len(c.orphans))
+	}
+}
@@ -0,0 +1,178 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"metrics/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// XygleAdapter is the ChainAdapter for xygle nodes, and the default.
+type XygleAdapter struct {
+	client *Client
+}
+
+func NewXygleAdapter(client *Client) *XygleAdapter {
+	return &XygleAdapter{client: client}
+}
+
+func (a *XygleAdapter) Name() string {
+	return "xygle"
+}
+
+// SubmitTransfer sends tx.Raw with xygle_sendRawTransaction, or asks node to
+// sign for its own address with xygle_transferFund.
+func (a *XygleAdapter) SubmitTransfer(ctx context.Context, node model.NodeInfo, tx Transfer) (string, error) {
+	if len(tx.Raw) > 0 {
+		return a.client.SendRawTransaction(ctx, node, tx.Raw)
+	}
+	return a.client.SubmitTransaction(ctx, node, "xygle_transferFund", TransferParams(tx.Receiver, tx.Value, tx.Nonce))
+}
+
+func (a *XygleAdapter) GetStatus(ctx context.Context, node model.NodeInfo, txID string) (TxStatus, error) {
+	detail, err := a.client.GetTransactionDetails(ctx, node, txID)
+	if err != nil {
+		return TxStatus{}, err
+	}
+	return XygleStatus(detail), nil
+}
+
+func (a *XygleAdapter) GetStatuses(ctx context.Context, node model.NodeInfo, txIDs []string) map[string]StatusResult {
+	results := make(map[string]StatusResult, len(txIDs))
+	for txID, res := range a.client.GetTransactionDetailsBatch(ctx, node, txIDs) {
+		if res.Err != nil {
+			results[txID] = StatusResult{Err: res.Err}
+			continue
+		}
+		results[txID] = StatusResult{Status: XygleStatus(res.Detail)}
+	}
+	return results
+}
+
+// findPages and findPageSize bound how much of an account's history
+// FindTransaction reads.
+const (
+	findPages    = 5
+	findPageSize = 100
+)
+
+// FindTransaction looks a locally signed transaction up by its hash, and
+// any other by scanning the most recent history of sender for nonce.
+func (a *XygleAdapter) FindTransaction(ctx context.Context, node model.NodeInfo, sender string, nonce uint64, hash string) (TxStatus, error) {
+	if hash != "" {
+		return a.GetStatus(ctx, node, hash)
+	}
+	cursor := ""
+	for i := 0; i < findPages; i++ {
+		page, err := a.client.GetTransactions(ctx, node, sender, cursor, findPageSize)
+		if err != nil {
+			return TxStatus{}, err
+		}
+		for _, tx := range page.Transactions {
+			if tx.Sender == sender && tx.Nonce == nonce {
+				return XygleStatus(tx), nil
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	return TxStatus{}, &Error{Kind: ErrNotFound, Method: "xygle_getTransactions",
+		Message: fmt.Sprintf("no transaction from %s with nonce %d", sender, nonce)}
+}
+
+// GetNonce returns one past the nonce of the last executed transaction of
+// address.
+func (a *XygleAdapter) GetNonce(ctx context.Context, node model.NodeInfo, address string) (uint64, error) {
+	state, err := a.client.GetAccountState(ctx, node, address)
+	if err != nil {
+		return 0, err
+	}
+	return state.Nonce + 1, nil
+}
+
+func (a *XygleAdapter) GetBalance(ctx context.Context, node model.NodeInfo, address string) (*big.Int, error) {
+	state, err := a.client.GetAccountState(ctx, node, address)
+	if err != nil {
+		return nil, err
+	}
+	return state.Balance, nil
+}
+
+// SubscribeStatuses subscribes once per address on a single connection and
+// merges the streams.
+func (a *XygleAdapter) SubscribeStatuses(ctx context.Context, node model.NodeInfo, addresses []string) (*StatusStream, error) {
+	ws, err := a.client.DialWS(ctx, node.WSURL)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]*Subscription, 0, len(addresses))
+	streams := make([]<-chan model.TransactionResult, 0, len(addresses))
+	for _, address := range addresses {
+		sub, events, err := ws.SubscribeTransactions(ctx, address)
+		if err != nil {
+			ws.Close()
+			return nil, err
+		}
+		subs = append(subs, sub)
+		streams = append(streams, events)
+	}
+
+	out := make(chan TxStatus, 1024)
+	var wg sync.WaitGroup
+	for _, events := range streams {
+		wg.Add(1)
+		go func(events <-chan model.TransactionResult) {
+			defer wg.Done()
+			for detail := range events {
+				select {
+				case out <- XygleStatus(detail):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return &StatusStream{
+		Events: out,
+		close: func() {
+			for _, sub := range subs {
+				unsubCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				sub.Unsubscribe(unsubCtx)
+				cancel()
+			}
+			ws.Close()
+		},
+	}, nil
+}
+
+// XygleStatus normalises a xygle transaction status. Only "SUCCESS" counts
+// as a successful execution.
+func XygleStatus(detail model.TransactionResult) TxStatus {
+	st := TxStatus{
+		ID:         detail.ID,
+		Status:     StatusPending,
+		ExecutedAt: detail.ExecutionTimestamp,
+		Detail:     detail.ExecutionStatus,
+	}
+	switch strings.ToUpper(detail.ExecutionStatus) {
+	case "SUCCESS":
+		st.Status = StatusExecuted
+		if detail.IsFinal {
+			st.Status = StatusFinal
+		}
+	case "FAILED", "FAILURE", "REVERTED", "ERROR":
+		st.Status = StatusFailed
+	}
+	return st
+}
@@ -0,0 +1,62 @@
+package rpctest
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Delay is a distribution of durations, sampled once per transaction.
+type Delay interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// Fixed always returns the same duration.
+type Fixed time.Duration
+
+func (d Fixed) Sample(*rand.Rand) time.Duration {
+	return time.Duration(d)
+}
+
+// Uniform samples uniformly from [Min, Max].
+type Uniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (d Uniform) Sample(r *rand.Rand) time.Duration {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + time.Duration(r.Int63n(int64(d.Max-d.Min)+1))
+}
+
+// Exponential samples from an exponential distribution with the given mean,
+// which gives the long tail typical of confirmation times.
+type Exponential struct {
+	Mean time.Duration
+}
+
+func (d Exponential) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(d.Mean))
+}
+
+// Normal samples from a normal distribution, clamped at zero.
+type Normal struct {
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+func (d Normal) Sample(r *rand.Rand) time.Duration {
+	v := time.Duration(r.NormFloat64()*float64(d.StdDev)) + d.Mean
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+func sample(d Delay, r *rand.Rand) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.Sample(r)
+}
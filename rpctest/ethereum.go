@@ -0,0 +1,246 @@
+package rpctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dispatchEthereum answers the Ethereum-style methods used by
+// rpc.EthereumAdapter against the same ledger. Every executed transaction
+// gets a block of its own, a block is finalized once its transaction and
+// all earlier ones are final, the pending block holds the transactions not
+// executed yet, and transaction hashes are the xygle IDs with a 0x prefix. Nonces are numbered as in the xygle methods, and
+// eth_sendRawTransaction takes transactions encoded by the signer package.
+func (s *Server) dispatchEthereum(method string, params json.RawMessage) (interface{}, error) {
+	var args []json.RawMessage
+	if err := decodeParams(params, &args); err != nil {
+		return nil, err
+	}
+	arg := func(i int, v interface{}) error {
+		if i >= len(args) {
+			return &rpcError{code: -32602, message: fmt.Sprintf("invalid params: missing argument %d", i)}
+		}
+		return decodeParams(args[i], v)
+	}
+
+	switch method {
+	case "eth_sendTransaction":
+		var tx struct {
+			From  string `json:"from"`
+			To    string `json:"to"`
+			Value string `json:"value"`
+			Nonce string `json:"nonce"`
+		}
+		if err := arg(0, &tx); err != nil {
+			return nil, err
+		}
+		if tx.From != s.cfg.NodeAddress {
+			return nil, fmt.Errorf("unknown account %s", tx.From)
+		}
+		value, err := parseQuantity(tx.Value)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := parseQuantity(tx.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		id, err := s.transferFund(tx.From, tx.To, value, nonce, "")
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + id, nil
+
+	case "eth_sendRawTransaction":
+		var raw string
+		if err := arg(0, &raw); err != nil {
+			return nil, err
+		}
+		id, err := s.sendRaw(raw)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + id, nil
+
+	case "eth_getTransactionReceipt":
+		var hash string
+		if err := arg(0, &hash); err != nil {
+			return nil, err
+		}
+		return s.getReceipt(strings.TrimPrefix(hash, "0x")), nil
+
+	case "eth_getTransactionByHash":
+		var hash string
+		if err := arg(0, &hash); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.advance(time.Now())
+		tx, ok := s.txs[strings.TrimPrefix(hash, "0x")]
+		if !ok {
+			return nil, nil
+		}
+		return tx.ethObject(), nil
+
+	case "eth_getTransactionCount":
+		var address, tag string
+		if err := arg(0, &address); err != nil {
+			return nil, err
+		}
+		arg(1, &tag)
+		return s.transactionCount(address, tag == "pending"), nil
+
+	case "eth_getBalance":
+		var address string
+		if err := arg(0, &address); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.advance(time.Now())
+		return quantity(s.account(address).balance), nil
+
+	case "eth_blockNumber":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.advance(time.Now())
+		return quantity(uint64(len(s.blocks))), nil
+
+	case "eth_getBlockByNumber":
+		var tag string
+		var full bool
+		if err := arg(0, &tag); err != nil {
+			return nil, err
+		}
+		arg(1, &full)
+		return s.getBlock(tag, full)
+	}
+	return nil, &rpcError{code: -32601, message: fmt.Sprintf("method %s not found", method)}
+}
+
+func (s *Server) getReceipt(id string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.advance(time.Now())
+	defer s.notify(events)
+
+	tx, ok := s.txs[id]
+	if !ok || tx.block == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"transactionHash": "0x" + tx.id,
+		"blockNumber":     quantity(tx.block),
+		"from":            tx.sender,
+		"to":              tx.receiver,
+		"status":          "0x1",
+	}
+}
+
+// transactionCount returns the next nonce of address, counting queued
+// transactions that would execute next if pending is set.
+func (s *Server) transactionCount(address string, pending bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+
+	acct := s.account(address)
+	next := acct.nonce + 1
+	for pending && acct.pending[next] != nil {
+		next++
+	}
+	return quantity(next)
+}
+
+// ethObject is tx as returned by eth_getTransactionByHash, with a null
+// blockNumber until it executes. Callers hold s.mu.
+func (tx *transaction) ethObject() map[string]interface{} {
+	obj := map[string]interface{}{
+		"hash":        "0x" + tx.id,
+		"from":        tx.sender,
+		"to":          tx.receiver,
+		"value":       quantity(tx.value),
+		"nonce":       quantity(tx.nonce),
+		"blockNumber": nil,
+	}
+	if tx.block > 0 {
+		obj["blockNumber"] = quantity(tx.block)
+	}
+	return obj
+}
+
+func (s *Server) getBlock(tag string, full bool) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+
+	var number uint64
+	var txs []*transaction
+	switch tag {
+	case "pending":
+		number = uint64(len(s.blocks)) + 1
+		for _, acct := range s.accounts {
+			for _, tx := range acct.pending {
+				txs = append(txs, tx)
+			}
+		}
+		slices.SortFunc(txs, func(a, b *transaction) int { return a.submitted.Compare(b.submitted) })
+	case "latest":
+		number = uint64(len(s.blocks))
+	case "finalized", "safe":
+		number = uint64(s.finalHeight)
+	case "earliest":
+		number = 0
+	default:
+		n, err := parseQuantity(tag)
+		if err != nil {
+			return nil, err
+		}
+		number = n
+	}
+	if tag != "pending" && number > uint64(len(s.blocks)) {
+		return nil, nil
+	}
+
+	timestamp := s.started
+	if tag == "pending" {
+		timestamp = time.Now()
+	} else if number > 0 {
+		tx := s.blocks[number-1]
+		timestamp = tx.executedAt
+		txs = []*transaction{tx}
+	}
+	transactions := make([]interface{}, len(txs))
+	for i, tx := range txs {
+		if full {
+			transactions[i] = tx.ethObject()
+		} else {
+			transactions[i] = "0x" + tx.id
+		}
+	}
+	return map[string]interface{}{
+		"number":       quantity(number),
+		"timestamp":    quantity(uint64(timestamp.Unix())),
+		"transactions": transactions,
+	}, nil
+}
+
+func quantity(v uint64) string {
+	return "0x" + strconv.FormatUint(v, 16)
+}
+
+func parseQuantity(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, &rpcError{code: -32602, message: fmt.Sprintf("invalid params: quantity %q is not 0x-prefixed", s)}
+	}
+	v, err := strconv.ParseUint(s[2:], 16, 64)
+	if err != nil {
+		return 0, &rpcError{code: -32602, message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return v, nil
+}
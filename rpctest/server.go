@@ -0,0 +1,863 @@
+// Package rpctest provides an in-process xygle JSON-RPC node for tests and
+// offline runs. It keeps an in-memory ledger with per-account nonces,
+// executes transfers in nonce order after a configurable delay, marks them
+// final after a second delay, and can inject failures. The same ledger is
+// also served through Ethereum-style eth_ methods.
+package rpctest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"metrics/models"
+	"metrics/rpc"
+	"metrics/signer"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNodeAddress = "0xmocknode"
+	DefaultBalance     = uint64(1_000_000_000)
+
+	statusPending = "PENDING"
+	statusSuccess = "SUCCESS"
+)
+
+// Failures sets the probability (0..1) of each injected failure.
+type Failures struct {
+	// ServerError answers any HTTP request with 503 Service Unavailable.
+	ServerError float64
+	// RateLimited answers any HTTP request with 429 Too Many Requests.
+	RateLimited float64
+	// RetryAfter, if set, is sent as a Retry-After header with injected
+	// 503 and 429 replies.
+	RetryAfter time.Duration
+	// NonceError rejects xygle_transferFund with "nonce too low".
+	NonceError float64
+	// NotFound answers xygle_getTransaction with "transaction not found"
+	// even for known transactions.
+	NotFound float64
+	// LostReply accepts a submission but closes the connection instead of
+	// answering, so the client cannot tell whether it landed.
+	LostReply float64
+}
+
+type Config struct {
+	// NodeAddress is the account the node signs xygle_transferFund for.
+	// Other accounts submit with xygle_sendRawTransaction.
+	NodeAddress string
+	// Balances seeds the ledger. NodeAddress gets DefaultBalance unless
+	// listed.
+	Balances map[string]uint64
+	// ExecutionDelay is sampled per transaction, from acceptance to
+	// execution. Transactions of one account still execute in nonce order.
+	ExecutionDelay Delay
+	// FinalityDelay is sampled per transaction, from execution to finality.
+	FinalityDelay Delay
+	Failures      Failures
+	// Seed makes delays and failure injection reproducible.
+	Seed int64
+	// TLS serves HTTPS and WSS with a self-signed certificate, available
+	// from Certificate.
+	TLS bool
+	// ClientCAs, with TLS, requires client certificates signed by one of
+	// these CAs.
+	ClientCAs *x509.CertPool
+	// RequireHeader answers requests, including WebSocket handshakes, that
+	// lack any of these header values with 401 Unauthorized.
+	RequireHeader http.Header
+}
+
+// Stats counts what the node has seen.
+type Stats struct {
+	Requests         int
+	Transfers        int
+	Rejected         int
+	Executed         int
+	Finalized        int
+	InjectedFailures int
+}
+
+type transaction struct {
+	id         string
+	sender     string
+	receiver   string
+	value      uint64
+	nonce      uint64
+	submitted  time.Time
+	readyAt    time.Time
+	finalDelay time.Duration
+	executedAt time.Time
+	finalAt    time.Time
+	status     string
+	final      bool
+	// block is the number of the block the transaction executed in, one
+	// block per transaction, as seen by the eth_ methods.
+	block uint64
+}
+
+type account struct {
+	balance  uint64
+	nonce    uint64 // highest executed nonce
+	lastExec time.Time
+	pending  map[uint64]*transaction
+	reserved uint64
+}
+
+// Server is a mock xygle node served over httptest. Besides submission and
+// status lookups it answers the balance, transaction list, account activity
+// and node stats queries. JSON-RPC is accepted on every path except /ws,
+// which serves WebSocket subscriptions.
+type Server struct {
+	cfg  Config
+	http *httptest.Server
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	accounts map[string]*account
+	txs      map[string]*transaction
+	unfinal  []*transaction
+	stats    Stats
+	// history lists the transactions of each account, oldest first.
+	history map[string][]*transaction
+	// blocks lists executed transactions in execution order; transaction
+	// i is block i+1. finalHeight is the highest block whose transaction
+	// and all before it are final.
+	blocks      []*transaction
+	finalHeight int
+	started     time.Time
+
+	subsMu  sync.Mutex
+	subs    map[*subscriber]struct{}
+	nextSub int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.NodeAddress == "" {
+		cfg.NodeAddress = DefaultNodeAddress
+	}
+	s := &Server{
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		accounts: make(map[string]*account),
+		txs:      make(map[string]*transaction),
+		history:  make(map[string][]*transaction),
+		started:  time.Now(),
+		subs:     make(map[*subscriber]struct{}),
+		stop:     make(chan struct{}),
+	}
+	for addr, bal := range cfg.Balances {
+		s.account(addr).balance = bal
+	}
+	if _, ok := cfg.Balances[cfg.NodeAddress]; !ok {
+		s.account(cfg.NodeAddress).balance = DefaultBalance
+	}
+
+	s.http = httptest.NewUnstartedServer(s)
+	if cfg.TLS {
+		if cfg.ClientCAs != nil {
+			s.http.TLS = &tls.Config{ClientCAs: cfg.ClientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+		}
+		s.http.StartTLS()
+	} else {
+		s.http.Start()
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Certificate returns the server's certificate when serving TLS, and nil
+// otherwise.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.http.Certificate()
+}
+
+func (s *Server) WSURL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http") + "/ws"
+}
+
+// Node describes the server as a node that signs for NodeAddress.
+func (s *Server) Node() model.NodeInfo {
+	return model.NodeInfo{
+		NodeType: "mock",
+		URL:      s.URL(),
+		Address:  s.cfg.NodeAddress,
+		WSURL:    s.WSURL(),
+	}
+}
+
+func (s *Server) Close() {
+	close(s.stop)
+	s.wg.Wait()
+
+	s.subsMu.Lock()
+	for sub := range s.subs {
+		sub.conn.Close()
+	}
+	s.subsMu.Unlock()
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+func (s *Server) Balance(address string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	return s.account(address).balance
+}
+
+// Nonce returns the highest executed nonce of address.
+func (s *Server) Nonce(address string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	return s.account(address).nonce
+}
+
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// run executes and finalizes transactions as their delays elapse, so
+// subscribers are notified without waiting for a poll.
+func (s *Server) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			events := s.advance(time.Now())
+			s.mu.Unlock()
+			s.notify(events)
+		}
+	}
+}
+
+// advance applies every execution and finality due at now and returns the
+// resulting status snapshots. Callers hold s.mu.
+func (s *Server) advance(now time.Time) []model.TransactionResult {
+	var events []model.TransactionResult
+
+	for _, acct := range s.accounts {
+		for {
+			tx := acct.pending[acct.nonce+1]
+			if tx == nil || tx.readyAt.After(now) {
+				break
+			}
+			delete(acct.pending, tx.nonce)
+			acct.reserved -= tx.value
+			acct.balance -= tx.value
+			s.account(tx.receiver).balance += tx.value
+			acct.nonce = tx.nonce
+
+			tx.executedAt = tx.readyAt
+			if tx.executedAt.Before(acct.lastExec) {
+				tx.executedAt = acct.lastExec
+			}
+			acct.lastExec = tx.executedAt
+			tx.finalAt = tx.executedAt.Add(tx.finalDelay)
+			tx.status = statusSuccess
+			s.blocks = append(s.blocks, tx)
+			tx.block = uint64(len(s.blocks))
+			s.unfinal = append(s.unfinal, tx)
+			s.stats.Executed++
+			events = append(events, tx.result())
+		}
+	}
+
+	remaining := s.unfinal[:0]
+	for _, tx := range s.unfinal {
+		if tx.finalAt.After(now) {
+			remaining = append(remaining, tx)
+			continue
+		}
+		tx.final = true
+		s.stats.Finalized++
+		events = append(events, tx.result())
+	}
+	s.unfinal = remaining
+	for s.finalHeight < len(s.blocks) && s.blocks[s.finalHeight].final {
+		s.finalHeight++
+	}
+
+	return events
+}
+
+func (s *Server) account(address string) *account {
+	acct, ok := s.accounts[address]
+	if !ok {
+		acct = &account{pending: make(map[uint64]*transaction)}
+		s.accounts[address] = acct
+	}
+	return acct
+}
+
+func (s *Server) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	if s.rng.Float64() < p {
+		s.stats.InjectedFailures++
+		return true
+	}
+	return false
+}
+
+func (tx *transaction) result() model.TransactionResult {
+	r := model.TransactionResult{
+		ID:              tx.id,
+		Sender:          tx.sender,
+		Receiver:        tx.receiver,
+		Value:           int64(tx.value),
+		Nonce:           tx.nonce,
+		Timestamp:       tx.submitted.Unix(),
+		ExecutionStatus: tx.status,
+		IsFinal:         tx.final,
+	}
+	if tx.status == statusSuccess {
+		r.ExecutionTimestamp = tx.executedAt.Unix()
+		r.ExecutionResult = fmt.Sprintf("Transferred %d from %s to %s", tx.value, tx.sender, tx.receiver)
+	}
+	return r
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *model.RPCError `json:"error,omitempty"`
+}
+
+// rpcError is returned by method handlers to produce a JSON-RPC error object.
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.message
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for name, values := range s.cfg.RequireHeader {
+		for _, value := range values {
+			if !slices.Contains(r.Header.Values(name), value) {
+				http.Error(w, fmt.Sprintf("missing or invalid %s header", name), http.StatusUnauthorized)
+				return
+			}
+		}
+	}
+
+	if r.URL.Path == "/ws" {
+		s.serveWS(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.stats.Requests++
+	status := 0
+	switch {
+	case s.chance(s.cfg.Failures.ServerError):
+		status = http.StatusServiceUnavailable
+	case s.chance(s.cfg.Failures.RateLimited):
+		status = http.StatusTooManyRequests
+	}
+	s.mu.Unlock()
+	if status != 0 {
+		if s.cfg.Failures.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.cfg.Failures.RetryAfter.Seconds()))))
+		}
+		http.Error(w, "injected failure", status)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []request
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			json.NewEncoder(w).Encode(parseError())
+			return
+		}
+		out := make([]response, len(batch))
+		for i, req := range batch {
+			out[i] = s.handle(req)
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		json.NewEncoder(w).Encode(parseError())
+		return
+	}
+	resp := s.handle(req)
+	if resp.Error == nil && isSubmission(req.Method) {
+		s.mu.Lock()
+		lost := s.chance(s.cfg.Failures.LostReply)
+		s.mu.Unlock()
+		if hj, ok := w.(http.Hijacker); lost && ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func isSubmission(method string) bool {
+	return method == "xygle_transferFund" || method == "xygle_sendRawTransaction"
+}
+
+func parseError() response {
+	return response{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage("null"),
+		Error:   &model.RPCError{Code: -32700, Message: "parse error"},
+	}
+}
+
+func (s *Server) handle(req request) response {
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+
+	result, err := s.dispatch(req.Method, req.Params)
+	if err != nil {
+		code := -32000
+		if e, ok := err.(*rpcError); ok {
+			code = e.code
+		}
+		resp.Error = &model.RPCError{Code: code, Message: err.Error()}
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+func (s *Server) dispatch(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "xygle_getAccountState":
+		var p struct {
+			Address string `json:"address"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getAccountState(p.Address), nil
+
+	case "xygle_transferFund":
+		var p struct {
+			Receiver string `json:"receiver"`
+			Value    uint64 `json:"value"`
+			Nonce    uint64 `json:"nonce"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return accepted(s.transferFund(s.cfg.NodeAddress, p.Receiver, p.Value, p.Nonce, ""))
+
+	case "xygle_getTransaction":
+		var p struct {
+			ID string `json:"id"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getTransaction(p.ID)
+
+	case "xygle_sendRawTransaction":
+		var p struct {
+			Raw string `json:"raw"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return accepted(s.sendRaw(p.Raw))
+
+	case "xygle_getBalance":
+		var p struct {
+			Address string `json:"address"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		state := s.getAccountState(p.Address)
+		return map[string]interface{}{"address": p.Address, "balance": state["balance"]}, nil
+
+	case "xygle_getTransactions":
+		var p struct {
+			Address string `json:"address"`
+			Cursor  string `json:"cursor"`
+			Limit   int    `json:"limit"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getTransactions(p.Address, p.Cursor, p.Limit)
+
+	case "xygle_getAccountActivity":
+		var p struct {
+			Address string `json:"address"`
+			Limit   int    `json:"limit"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getAccountActivity(p.Address, p.Limit), nil
+
+	case "xygle_getNodeStats":
+		return s.getNodeStats(), nil
+	}
+	if strings.HasPrefix(method, "eth_") {
+		return s.dispatchEthereum(method, params)
+	}
+	return nil, &rpcError{code: -32601, message: fmt.Sprintf("method %s not found", method)}
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{code: -32602, message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+func (s *Server) getAccountState(address string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	acct := s.account(address)
+	return map[string]interface{}{
+		"address": address,
+		"nonce":   acct.nonce,
+		"balance": acct.balance,
+	}
+}
+
+// accepted builds the xygle submission result for a transaction ID.
+func accepted(id string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"status":         "ACCEPTED",
+		"transaction_id": id,
+	}, nil
+}
+
+// sendRaw verifies and submits a hex transaction signed with the signer
+// package. Its ID is the hash of the signed transfer.
+func (s *Server) sendRaw(rawHex string) (string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(rawHex, "0x"))
+	if err != nil {
+		return "", &rpcError{code: -32602, message: fmt.Sprintf("invalid params: raw: %v", err)}
+	}
+	tx, err := signer.DecodeRaw(raw)
+	if err != nil {
+		return "", &rpcError{code: -32602, message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	if err := tx.Verify(); err != nil {
+		s.mu.Lock()
+		s.stats.Transfers++
+		s.stats.Rejected++
+		s.mu.Unlock()
+		return "", err
+	}
+	return s.transferFund(tx.Sender, tx.Receiver, tx.Value, tx.Nonce, tx.Hash())
+}
+
+// transferFund queues a transfer and returns its ID, which is id if set and
+// otherwise made up.
+func (s *Server) transferFund(sender, receiver string, value, nonce uint64, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	events := s.advance(now)
+	defer s.notify(events)
+
+	s.stats.Transfers++
+	acct := s.account(sender)
+	switch {
+	case s.chance(s.cfg.Failures.NonceError), nonce <= acct.nonce:
+		s.stats.Rejected++
+		return "", fmt.Errorf("nonce too low: got %d, account nonce is %d", nonce, acct.nonce)
+	case acct.pending[nonce] != nil:
+		s.stats.Rejected++
+		return "", fmt.Errorf("invalid nonce: %d is already pending", nonce)
+	case acct.balance-acct.reserved < value:
+		s.stats.Rejected++
+		return "", fmt.Errorf("insufficient funds: balance %d, pending %d, value %d", acct.balance, acct.reserved, value)
+	}
+
+	if id == "" {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%d", sender, receiver, value, nonce, now.UnixNano())))
+		id = hex.EncodeToString(sum[:])
+	}
+	tx := &transaction{
+		id:         id,
+		sender:     sender,
+		receiver:   receiver,
+		value:      value,
+		nonce:      nonce,
+		submitted:  now,
+		readyAt:    now.Add(sample(s.cfg.ExecutionDelay, s.rng)),
+		finalDelay: sample(s.cfg.FinalityDelay, s.rng),
+		status:     statusPending,
+	}
+	acct.pending[nonce] = tx
+	acct.reserved += value
+	s.txs[tx.id] = tx
+	s.history[sender] = append(s.history[sender], tx)
+	if receiver != sender {
+		s.history[receiver] = append(s.history[receiver], tx)
+	}
+
+	return tx.id, nil
+}
+
+func (s *Server) getTransaction(id string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.advance(time.Now())
+	defer s.notify(events)
+
+	tx, ok := s.txs[id]
+	if !ok || s.chance(s.cfg.Failures.NotFound) {
+		return nil, fmt.Errorf("transaction %s not found", id)
+	}
+	return tx.result(), nil
+}
+
+const defaultPageSize = 20
+
+// getTransactions pages through the history of address, newest first. The
+// cursor is the number of entries already returned.
+func (s *Server) getTransactions(address, cursor string, limit int) (interface{}, error) {
+	offset := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			return nil, &rpcError{code: -32602, message: fmt.Sprintf("invalid cursor %q", cursor)}
+		}
+		offset = n
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+
+	history := s.history[address]
+	txs := []model.TransactionResult{}
+	for i := len(history) - 1 - offset; i >= 0 && len(txs) < limit; i-- {
+		txs = append(txs, history[i].result())
+	}
+	page := map[string]interface{}{"transactions": txs}
+	if next := offset + len(txs); next < len(history) {
+		page["next_cursor"] = strconv.Itoa(next)
+	}
+	return page, nil
+}
+
+func (s *Server) getAccountActivity(address string, limit int) []model.AccountActivity {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+
+	history := s.history[address]
+	activity := []model.AccountActivity{}
+	for i := len(history) - 1; i >= 0 && len(activity) < limit; i-- {
+		tx := history[i]
+		entry := model.AccountActivity{
+			TransactionID: tx.id,
+			Direction:     "sent",
+			Counterparty:  tx.receiver,
+			Value:         int64(tx.value),
+			Nonce:         tx.nonce,
+			Status:        tx.status,
+			Timestamp:     tx.submitted.Unix(),
+		}
+		if tx.sender != address {
+			entry.Direction = "received"
+			entry.Counterparty = tx.sender
+		}
+		activity = append(activity, entry)
+	}
+	return activity
+}
+
+func (s *Server) getNodeStats() model.NodeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.advance(now)
+
+	pending := 0
+	for _, acct := range s.accounts {
+		pending += len(acct.pending)
+	}
+	uptime := now.Sub(s.started)
+	return model.NodeStats{
+		NodeID:              s.cfg.NodeAddress,
+		Version:             "rpctest",
+		Height:              uint64(s.stats.Executed),
+		PendingTransactions: pending,
+		TotalTransactions:   uint64(len(s.txs)),
+		TPS:                 float64(s.stats.Executed) / uptime.Seconds(),
+		UptimeSeconds:       int64(uptime.Seconds()),
+		Synced:              true,
+	}
+}
+
+// subscriber is one WebSocket connection and its subscriptions, keyed by
+// subscription ID with an optional sender address filter.
+type subscriber struct {
+	conn *rpc.WSConn
+	mu   sync.Mutex
+	subs map[string]string
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := rpc.AcceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	sub := &subscriber{conn: conn, subs: make(map[string]string)}
+	s.subsMu.Lock()
+	s.subs[sub] = struct{}{}
+	s.subsMu.Unlock()
+
+	defer func() {
+		s.subsMu.Lock()
+		delete(s.subs, sub)
+		s.subsMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeJSON(conn, parseError())
+			continue
+		}
+
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		switch req.Method {
+		case "xygle_subscribe":
+			var p struct {
+				Topic   string `json:"topic"`
+				Address string `json:"address"`
+			}
+			if err := json.Unmarshal(req.Params, &p); err != nil || p.Topic != rpc.TopicTransactionStatus {
+				resp.Error = &model.RPCError{Code: -32602, Message: "unsupported subscription"}
+				break
+			}
+			s.subsMu.Lock()
+			s.nextSub++
+			id := fmt.Sprintf("0x%x", s.nextSub)
+			s.subsMu.Unlock()
+			sub.mu.Lock()
+			sub.subs[id] = p.Address
+			sub.mu.Unlock()
+			resp.Result = id
+		case "xygle_unsubscribe":
+			var p struct {
+				Subscription string `json:"subscription"`
+			}
+			json.Unmarshal(req.Params, &p)
+			sub.mu.Lock()
+			_, ok := sub.subs[p.Subscription]
+			delete(sub.subs, p.Subscription)
+			sub.mu.Unlock()
+			resp.Result = ok
+		default:
+			resp = s.handle(req)
+		}
+		writeJSON(conn, resp)
+	}
+}
+
+func (s *Server) notify(events []model.TransactionResult) {
+	if len(events) == 0 {
+		return
+	}
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for sub := range s.subs {
+		sub.mu.Lock()
+		for id, address := range sub.subs {
+			for _, ev := range events {
+				if address != "" && ev.Sender != address {
+					continue
+				}
+				writeJSON(sub.conn, map[string]interface{}{
+					"jsonrpc": "2.0",
+					"method":  "xygle_subscription",
+					"params":  map[string]interface{}{"subscription": id, "result": ev},
+				})
+			}
+		}
+		sub.mu.Unlock()
+	}
+}
+
+func writeJSON(conn *rpc.WSConn, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	conn.WriteMessage(data)
+}
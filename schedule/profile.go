@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is one stage of a load profile. Open-loop phases set Rate, and
+// EndRate to change it over the phase; closed-loop phases set Workers
+// instead.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+	// Rate is the target TPS at the start of the phase. EndRate, if not
+	// zero, is the target at the end, reached linearly or, with Steps, in
+	// that many equal steps.
+	Rate    float64
+	EndRate float64
+	Steps   int
+	// Workers runs the phase closed-loop: this many submissions in flight,
+	// each starting as soon as the previous one returns.
+	Workers int
+}
+
+// Validate reports a phase that cannot be run.
+func (p Phase) Validate() error {
+	switch {
+	case p.Duration <= 0:
+		return fmt.Errorf("phase %s: duration must be positive", p.Name)
+	case p.Workers > 0 && (p.Rate > 0 || p.EndRate > 0):
+		return fmt.Errorf("phase %s: set either a rate or workers, not both", p.Name)
+	case p.Workers == 0 && p.Rate <= 0 && p.EndRate <= 0:
+		return fmt.Errorf("phase %s: needs a rate or workers", p.Name)
+	case p.Rate < 0 || p.EndRate < 0:
+		return fmt.Errorf("phase %s: rates must not be negative", p.Name)
+	case p.Steps == 1:
+		return fmt.Errorf("phase %s: steps must be at least 2", p.Name)
+	}
+	return nil
+}
+
+func (p Phase) openLoop() bool {
+	return p.Workers == 0
+}
+
+func (p Phase) endRate() float64 {
+	if p.EndRate == 0 {
+		return p.Rate
+	}
+	return p.EndRate
+}
+
+// offset returns when, from the start of the phase, the expected number of
+// arrivals reaches n, and false if that is past the end of the phase.
+func (p Phase) offset(n float64) (time.Duration, bool) {
+	d := p.Duration.Seconds()
+	r0, r1 := p.Rate, p.endRate()
+
+	var t float64
+	switch {
+	case r0 == r1:
+		t = n / r0
+	case p.Steps >= 2:
+		// Piecewise constant: step j of Steps runs at r0 + j*(r1-r0)/(Steps-1)
+		width := d / float64(p.Steps)
+		t = math.Inf(1)
+		for j := 0; j < p.Steps; j++ {
+			rate := r0 + float64(j)*(r1-r0)/float64(p.Steps-1)
+			if rate > 0 && n <= rate*width {
+				t = float64(j)*width + n/rate
+				break
+			}
+			n -= rate * width
+		}
+	default:
+		// Linear: arrivals by t are r0*t + a*t^2/2
+		a := (r1 - r0) / d
+		disc := r0*r0 + 2*a*n
+		if disc < 0 {
+			return 0, false
+		}
+		t = (math.Sqrt(disc) - r0) / a
+	}
+	if t >= d || math.IsNaN(t) {
+		return 0, false
+	}
+	return time.Duration(t * float64(time.Second)), true
+}
+
+// Profile is a sequence of phases run back to back.
+type Profile []Phase
+
+// Validate reports the first phase that cannot be run.
+func (p Profile) Validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("profile has no phases")
+	}
+	for _, phase := range p {
+		if err := phase.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Duration is the total length of the profile.
+func (p Profile) Duration() time.Duration {
+	var total time.Duration
+	for _, phase := range p {
+		total += phase.Duration
+	}
+	return total
+}
+
+// Arrival is one call made by Profile.Run.
+type Arrival struct {
+	// Seq numbers arrivals across the whole profile, from 0.
+	Seq int
+	// Phase is the index of the phase the arrival belongs to.
+	Phase int
+	// Intended is when an open-loop phase meant the call to start; it is
+	// zero in closed-loop phases.
+	Intended time.Time
+}
+
+// Run moves through the phases on the wall clock, calling fire for every
+// arrival, until the profile ends or ctx is done. Open-loop phases call
+// fire in its own goroutine on schedule without waiting for earlier calls.
+// Their spacing comes from arrivals, which is called at the start of each
+// such phase for a scheduler at rate 1 (see Parse) whose offsets are mapped
+// onto the phase's rate. Closed-loop phases keep Workers calls running until
+// the phase ends. A call to fire that returns false, because there is
+// nothing left to send, ends the whole profile early. Run returns the number
+// of calls made, once all of them have returned.
+func (p Profile) Run(ctx context.Context, arrivals func() Scheduler, fire func(Arrival) bool) int {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	call := func(a Arrival) {
+		if !fire(a) {
+			stop()
+		}
+	}
+
+	var wg sync.WaitGroup
+	var seq atomic.Int64
+	next := func() int { return int(seq.Add(1) - 1) }
+
+	phaseStart := time.Now()
+	for i, phase := range p {
+		if ctx.Err() != nil {
+			break
+		}
+		phaseEnd := phaseStart.Add(phase.Duration)
+
+		if phase.openLoop() {
+			unit := arrivals()
+			for {
+				at, ok := phase.offset(unit.Next().Seconds())
+				if !ok {
+					break
+				}
+				intended := phaseStart.Add(at)
+				if !sleepUntil(ctx, intended) {
+					break
+				}
+				wg.Add(1)
+				go func(a Arrival) {
+					defer wg.Done()
+					call(a)
+				}(Arrival{Seq: next(), Phase: i, Intended: intended})
+			}
+			sleepUntil(ctx, phaseEnd)
+		} else {
+			var workers sync.WaitGroup
+			for w := 0; w < phase.Workers; w++ {
+				workers.Add(1)
+				go func(phase int) {
+					defer workers.Done()
+					for ctx.Err() == nil && time.Now().Before(phaseEnd) {
+						call(Arrival{Seq: next(), Phase: phase})
+					}
+				}(i)
+			}
+			workers.Wait()
+		}
+		phaseStart = phaseEnd
+	}
+	wg.Wait()
+	return int(seq.Load())
+}
+
+// sleepUntil waits until t and reports false if ctx was done first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
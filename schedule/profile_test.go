@@ -0,0 +1,37 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A source that runs out ends the profile instead of leaving its phases to
+// spin or idle until they are over.
+func TestProfileEndsWhenSourceRunsOut(t *testing.T) {
+	profile := Profile{
+		{Name: "closed", Duration: time.Minute, Workers: 4},
+		{Name: "open", Duration: time.Minute, Rate: 100},
+	}
+	unit := func() Scheduler {
+		s, err := Parse("constant", 1, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	var calls atomic.Int64
+	start := time.Now()
+	made := profile.Run(context.Background(), unit, func(Arrival) bool {
+		return calls.Add(1) <= 10
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %v after the source ran out", elapsed)
+	}
+	// Each worker may make one more call before it sees the end
+	if made < 11 || made > 14 {
+		t.Errorf("Run made %d calls, want 11 to 14", made)
+	}
+}
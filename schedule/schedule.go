@@ -0,0 +1,127 @@
+// Package schedule generates open-loop arrival times. Transactions are
+// issued when the schedule says, whether or not earlier ones have returned,
+// so a slow node shows up as latency instead of as a lower send rate.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler yields the intended start time of each successive arrival, as
+// an offset from the start of the run. Offsets never decrease.
+type Scheduler interface {
+	Next() time.Duration
+}
+
+// Constant spaces arrivals exactly 1/Rate apart.
+type Constant struct {
+	Rate float64
+	n    int64
+}
+
+func (s *Constant) Next() time.Duration {
+	at := time.Duration(float64(s.n) / s.Rate * float64(time.Second))
+	s.n++
+	return at
+}
+
+// TokenBucket lets Burst arrivals through at once and then refills at Rate
+// per second. Because arrivals never wait for each other, the bucket only
+// empties once: the first Burst arrivals are due immediately and the rest
+// follow at Rate.
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+	n     int64
+}
+
+func (s *TokenBucket) Next() time.Duration {
+	burst := int64(s.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	var at time.Duration
+	if s.n >= burst {
+		at = time.Duration(float64(s.n-burst+1) / s.Rate * float64(time.Second))
+	}
+	s.n++
+	return at
+}
+
+// Poisson draws exponentially distributed gaps with mean 1/Rate, modelling
+// independent clients.
+type Poisson struct {
+	Rate float64
+	rng  *rand.Rand
+	at   time.Duration
+}
+
+// NewPoisson returns a Poisson schedule whose gaps are drawn from seed.
+func NewPoisson(rate float64, seed int64) *Poisson {
+	return &Poisson{Rate: rate, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *Poisson) Next() time.Duration {
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	at := s.at
+	s.at += time.Duration(s.rng.ExpFloat64() / s.Rate * float64(time.Second))
+	return at
+}
+
+// Parse returns the scheduler named arrivals, which is constant (default),
+// token_bucket or poisson. burst only applies to token_bucket and seed only
+// to poisson.
+func Parse(arrivals string, rate float64, burst int, seed int64) (Scheduler, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %v", rate)
+	}
+	switch strings.ToLower(strings.ReplaceAll(arrivals, "-", "_")) {
+	case "", "constant":
+		return &Constant{Rate: rate}, nil
+	case "token_bucket":
+		return &TokenBucket{Rate: rate, Burst: burst}, nil
+	case "poisson":
+		return NewPoisson(rate, seed), nil
+	}
+	return nil, fmt.Errorf("unknown arrivals %q (want constant, token_bucket or poisson)", arrivals)
+}
+
+// Dispatch calls fire in its own goroutine at each time s schedules, n
+// times or until ctx is done, without waiting for earlier calls to return.
+// intended is when the call was due; it is earlier than the actual start
+// when the dispatcher itself falls behind. Dispatch returns the number of
+// calls made, once all of them have returned.
+func Dispatch(ctx context.Context, s Scheduler, n int, fire func(i int, intended time.Time)) int {
+	var wg sync.WaitGroup
+	start := time.Now()
+	fired := 0
+	for ; fired < n; fired++ {
+		intended := start.Add(s.Next())
+		if wait := time.Until(intended); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, intended time.Time) {
+			defer wg.Done()
+			fire(i, intended)
+		}(fired, intended)
+	}
+	wg.Wait()
+	return fired
+}
@@ -0,0 +1,115 @@
+// Package signer signs xygle transfers locally so any account whose key is
+// available can be load-tested, not only the accounts a node signs for.
+package signer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Key is an ed25519 account key.
+type Key struct {
+	priv    ed25519.PrivateKey
+	address string
+}
+
+func newKey(priv ed25519.PrivateKey) *Key {
+	return &Key{priv: priv, address: AddressOf(priv.Public().(ed25519.PublicKey))}
+}
+
+func GenerateKey() (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return newKey(priv), nil
+}
+
+// KeyFromHex parses a hex-encoded 32-byte seed or 64-byte private key, with
+// or without a 0x prefix.
+func KeyFromHex(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding: %w", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return newKey(ed25519.NewKeyFromSeed(b)), nil
+	case ed25519.PrivateKeySize:
+		return newKey(ed25519.NewKeyFromSeed(b[:ed25519.SeedSize])), nil
+	}
+	return nil, fmt.Errorf("invalid key length %d, want %d or %d bytes", len(b), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// LoadKey reads a key file holding one hex-encoded key.
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	key, err := KeyFromHex(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadKeys loads every path, which is either a key file or a directory whose
+// *.key files are loaded in name order. Duplicate accounts are dropped.
+func LoadKeys(paths ...string) ([]*Key, error) {
+	var keys []*Key
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to read key: %w", err)
+		} else if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(path, "*.key")); err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			key, err := LoadKey(file)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[key.address] {
+				seen[key.address] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Address is the account address the key signs for.
+func (k *Key) Address() string {
+	return k.address
+}
+
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.priv.Public().(ed25519.PublicKey)
+}
+
+// Hex returns the hex-encoded seed, as accepted by KeyFromHex.
+func (k *Key) Hex() string {
+	return hex.EncodeToString(k.priv.Seed())
+}
+
+// AddressOf derives an account address from a public key: the first 20
+// bytes of its SHA-256 hash, hex-encoded with a 0x prefix.
+func AddressOf(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "0x" + hex.EncodeToString(sum[:20])
+}
@@ -0,0 +1,64 @@
+package signer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeysRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var want []*Key
+	for _, name := range []string{"a.key", "b.key"} {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("0x"+key.Hex()+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, key)
+	}
+	// Not a key file, so not loaded
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory and a file in it hold the same account twice
+	keys, err := LoadKeys(dir, filepath.Join(dir, "a.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("loaded %d keys, want %d", len(keys), len(want))
+	}
+	for i, key := range keys {
+		if key.Address() != want[i].Address() || key.Hex() != want[i].Hex() {
+			t.Errorf("key %d: loaded %s, want %s", i, key.Address(), want[i].Address())
+		}
+	}
+}
+
+func TestKeyFromHex(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the seed half of a 64-byte private key is used
+	full, err := KeyFromHex(key.Hex() + "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Address() != key.Address() {
+		t.Errorf("64-byte key: address %s, want %s", full.Address(), key.Address())
+	}
+
+	for _, s := range []string{"", "0x1234", "zz" + key.Hex()[2:]} {
+		if _, err := KeyFromHex(s); err == nil {
+			t.Errorf("KeyFromHex(%q) succeeded", s)
+		}
+	}
+	if _, err := LoadKeys(filepath.Join(t.TempDir(), "missing.key")); err == nil {
+		t.Error("LoadKeys succeeded for a missing file")
+	}
+}
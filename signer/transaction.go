@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Transaction is an unsigned transfer.
+type Transaction struct {
+	Sender   string
+	Receiver string
+	Value    uint64
+	Nonce    uint64
+}
+
+// canonicalTx fixes the field order of the signed encoding: keys sorted,
+// no whitespace, integers as JSON numbers.
+type canonicalTx struct {
+	Nonce    uint64 `json:"nonce"`
+	Receiver string `json:"receiver"`
+	Sender   string `json:"sender"`
+	Value    uint64 `json:"value"`
+}
+
+// Encode returns the canonical encoding that is signed.
+func (tx Transaction) Encode() []byte {
+	b, _ := json.Marshal(canonicalTx{
+		Nonce:    tx.Nonce,
+		Receiver: tx.Receiver,
+		Sender:   tx.Sender,
+		Value:    tx.Value,
+	})
+	return b
+}
+
+// Hash is the SHA-256 hash of the canonical encoding, hex-encoded.
+func (tx Transaction) Hash() string {
+	sum := sha256.Sum256(tx.Encode())
+	return hex.EncodeToString(sum[:])
+}
+
+type SignedTransaction struct {
+	Transaction
+	PublicKey ed25519.PublicKey
+	Signature []byte
+}
+
+// Sign signs tx, whose Sender must be the key's address.
+func (k *Key) Sign(tx Transaction) (SignedTransaction, error) {
+	if tx.Sender != k.address {
+		return SignedTransaction{}, fmt.Errorf("key for %s cannot sign for sender %s", k.address, tx.Sender)
+	}
+	return SignedTransaction{
+		Transaction: tx,
+		PublicKey:   k.PublicKey(),
+		Signature:   ed25519.Sign(k.priv, tx.Encode()),
+	}, nil
+}
+
+// Verify checks that the signature is valid and that the public key belongs
+// to the sender.
+func (st SignedTransaction) Verify() error {
+	if len(st.PublicKey) != ed25519.PublicKeySize || AddressOf(st.PublicKey) != st.Sender {
+		return fmt.Errorf("%w: public key does not match sender %s", ErrInvalidSignature, st.Sender)
+	}
+	if !ed25519.Verify(st.PublicKey, st.Encode(), st.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// rawTx is the wire format of a signed transaction: the canonical fields
+// plus the hex-encoded public key and signature, again with sorted keys.
+type rawTx struct {
+	Nonce     uint64 `json:"nonce"`
+	PublicKey string `json:"public_key"`
+	Receiver  string `json:"receiver"`
+	Sender    string `json:"sender"`
+	Signature string `json:"signature"`
+	Value     uint64 `json:"value"`
+}
+
+// Raw encodes the signed transaction for xygle_sendRawTransaction.
+func (st SignedTransaction) Raw() []byte {
+	b, _ := json.Marshal(rawTx{
+		Nonce:     st.Nonce,
+		PublicKey: hex.EncodeToString(st.PublicKey),
+		Receiver:  st.Receiver,
+		Sender:    st.Sender,
+		Signature: hex.EncodeToString(st.Signature),
+		Value:     st.Value,
+	})
+	return b
+}
+
+// DecodeRaw parses the output of Raw. It does not verify the signature.
+func DecodeRaw(raw []byte) (SignedTransaction, error) {
+	var r rawTx
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return SignedTransaction{}, fmt.Errorf("invalid raw transaction: %w", err)
+	}
+	pub, err := hex.DecodeString(r.PublicKey)
+	if err != nil {
+		return SignedTransaction{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return SignedTransaction{}, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	return SignedTransaction{
+		Transaction: Transaction{
+			Sender:   r.Sender,
+			Receiver: r.Receiver,
+			Value:    r.Value,
+			Nonce:    r.Nonce,
+		},
+		PublicKey: pub,
+		Signature: sig,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// The key is test 1 of RFC 8032, whose public key is known.
+const testSeed = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+
+func TestSignKnownAnswer(t *testing.T) {
+	key, err := KeyFromHex(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(key.PublicKey()), "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"; got != want {
+		t.Fatalf("public key = %s, want %s", got, want)
+	}
+	if got, want := key.Address(), "0x21fe31dfa154a261626bf854046fd2271b7bed4b"; got != want {
+		t.Fatalf("address = %s, want %s", got, want)
+	}
+
+	tx := Transaction{
+		Sender:   key.Address(),
+		Receiver: "0x00000000000000000000000000000000000000ff",
+		Value:    1000,
+		Nonce:    7,
+	}
+	if got, want := string(tx.Encode()), `{"nonce":7,"receiver":"0x00000000000000000000000000000000000000ff","sender":"0x21fe31dfa154a261626bf854046fd2271b7bed4b","value":1000}`; got != want {
+		t.Errorf("encoding = %s\nwant       %s", got, want)
+	}
+	if got, want := tx.Hash(), "5846bf392217f3629a7d24c7209ba4a46dfcc3a8e25adcce6e3303eab904cb74"; got != want {
+		t.Errorf("hash = %s, want %s", got, want)
+	}
+
+	signed, err := key.Sign(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(signed.Signature), "09270f4041b1e94bd55a7dbd378e0503954542420669055de7cbbeb72e78dd614a5337ba19f1b93b457a9d791b14c12a65e7e8c1468d0600fa727a633dc39c08"; got != want {
+		t.Errorf("signature = %s\nwant        %s", got, want)
+	}
+	if err := signed.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	decoded, err := DecodeRaw(signed.Raw())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Errorf("Verify after DecodeRaw: %v", err)
+	}
+	if decoded.Transaction != tx {
+		t.Errorf("DecodeRaw = %+v, want %+v", decoded.Transaction, tx)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	key, err := KeyFromHex(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := key.Sign(Transaction{Sender: key.Address(), Receiver: "0xreceiver", Value: 1, Nonce: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := signed
+	changed.Value = 2
+	if err := changed.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed value: Verify = %v, want ErrInvalidSignature", err)
+	}
+	swapped := signed
+	swapped.PublicKey = other.PublicKey()
+	if err := swapped.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other public key: Verify = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := other.Sign(signed.Transaction); err == nil {
+		t.Error("signed for another account's sender")
+	}
+}
@@ -0,0 +1,124 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"metrics/parallel"
+	"strings"
+)
+
+func init() {
+	err := Register("transfer", func(spec Spec) (Workload, error) {
+		return NewTransfer(spec)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Transfer is the built-in workload: an endless sequence of transfers to
+// receivers and with values drawn from the distributions of its Spec.
+type Transfer struct {
+	receiver func() string
+	value    func() uint64
+	next     int
+}
+
+// NewTransfer builds a Transfer workload. Requests are numbered from 1 and
+// the same Seed always yields the same sequence.
+func NewTransfer(spec Spec) (*Transfer, error) {
+	if len(spec.Receivers) == 0 {
+		return nil, fmt.Errorf("workload: no receivers")
+	}
+	rng := rand.New(rand.NewSource(spec.Seed))
+
+	receiver, err := receiverPicker(rng, spec)
+	if err != nil {
+		return nil, err
+	}
+	value, err := valueSampler(rng, spec.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &Transfer{receiver: receiver, value: value}, nil
+}
+
+// Next returns the next transfer; the sequence never ends.
+func (t *Transfer) Next() (parallel.TransactionRequest, bool) {
+	t.next++
+	return parallel.TransactionRequest{
+		ID:       t.next,
+		Receiver: t.receiver(),
+		Value:    t.value(),
+	}, true
+}
+
+func receiverPicker(rng *rand.Rand, spec Spec) (func() string, error) {
+	receivers := spec.Receivers
+	switch strings.ToLower(spec.Distribution) {
+	case "", "uniform", "random":
+		return func() string { return receivers[rng.Intn(len(receivers))] }, nil
+	case "zipf":
+		s := spec.ZipfS
+		if s == 0 {
+			s = 1.1
+		}
+		if s <= 1 {
+			return nil, fmt.Errorf("workload: zipf_s must be above 1, got %v", s)
+		}
+		zipf := rand.NewZipf(rng, s, 1, uint64(len(receivers)-1))
+		return func() string { return receivers[zipf.Uint64()] }, nil
+	}
+	return nil, fmt.Errorf("workload: unknown receiver distribution %q (want uniform or zipf)", spec.Distribution)
+}
+
+func valueSampler(rng *rand.Rand, spec ValueSpec) (func() uint64, error) {
+	switch strings.ToLower(spec.Distribution) {
+	case "", "fixed":
+		value := spec.Value
+		if value == 0 {
+			value = 1
+		}
+		return func() uint64 { return value }, nil
+	case "uniform":
+		if spec.Max < spec.Min {
+			return nil, fmt.Errorf("workload: uniform values need min <= max, got %d and %d", spec.Min, spec.Max)
+		}
+		return func() uint64 { return spec.Min + uniform(rng, spec.Max-spec.Min+1) }, nil
+	case "normal":
+		if spec.StdDev < 0 || (spec.Max > 0 && spec.Max < spec.Min) {
+			return nil, fmt.Errorf("workload: normal values need stddev >= 0 and min <= max")
+		}
+		return func() uint64 {
+			v := math.Round(spec.Mean + rng.NormFloat64()*spec.StdDev)
+			if v <= float64(spec.Min) {
+				return spec.Min
+			}
+			if spec.Max > 0 && v >= float64(spec.Max) {
+				return spec.Max
+			}
+			if v >= math.MaxUint64 {
+				return math.MaxUint64
+			}
+			return uint64(v)
+		}, nil
+	}
+	return nil, fmt.Errorf("workload: unknown value distribution %q (want fixed, uniform or normal)", spec.Distribution)
+}
+
+// uniform returns a value in [0, n); n of zero stands for the whole uint64
+// range, the span of min 0 and max math.MaxUint64.
+func uniform(rng *rand.Rand, n uint64) uint64 {
+	if n == 0 {
+		return rng.Uint64()
+	}
+	if n <= math.MaxInt64 {
+		return uint64(rng.Int63n(int64(n)))
+	}
+	for {
+		if v := rng.Uint64(); v < n {
+			return v
+		}
+	}
+}
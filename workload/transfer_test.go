@@ -0,0 +1,138 @@
+package workload
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// sample draws n values from spec with a fixed seed.
+func sample(t *testing.T, spec ValueSpec, n int) []uint64 {
+	t.Helper()
+	value, err := valueSampler(rand.New(rand.NewSource(1)), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]uint64, n)
+	for i := range values {
+		values[i] = value()
+	}
+	return values
+}
+
+func TestFixedValues(t *testing.T) {
+	for _, spec := range []ValueSpec{{}, {Distribution: "fixed", Value: 7}} {
+		want := spec.Value
+		if want == 0 {
+			want = 1
+		}
+		for _, v := range sample(t, spec, 10) {
+			if v != want {
+				t.Fatalf("%+v: value %d, want %d", spec, v, want)
+			}
+		}
+	}
+}
+
+func TestUniformValues(t *testing.T) {
+	seen := make(map[uint64]int)
+	for _, v := range sample(t, ValueSpec{Distribution: "uniform", Min: 10, Max: 14}, 5000) {
+		if v < 10 || v > 14 {
+			t.Fatalf("value %d outside [10, 14]", v)
+		}
+		seen[v]++
+	}
+	// Each of the 5 values is expected 1000 times
+	for v := uint64(10); v <= 14; v++ {
+		if seen[v] < 800 || seen[v] > 1200 {
+			t.Errorf("value %d drawn %d times, want about 1000", v, seen[v])
+		}
+	}
+
+	// The whole uint64 range
+	for _, v := range sample(t, ValueSpec{Distribution: "uniform", Min: 0, Max: math.MaxUint64}, 100) {
+		if v > math.MaxInt64 {
+			return
+		}
+	}
+	t.Error("no value above math.MaxInt64 in the full range")
+}
+
+func TestNormalValues(t *testing.T) {
+	values := sample(t, ValueSpec{Distribution: "normal", Mean: 100, StdDev: 10, Min: 1, Max: 500}, 10000)
+	var sum, sumSq float64
+	for _, v := range values {
+		sum += float64(v)
+		sumSq += float64(v) * float64(v)
+	}
+	mean := sum / float64(len(values))
+	stddev := math.Sqrt(sumSq/float64(len(values)) - mean*mean)
+	if math.Abs(mean-100) > 1 || math.Abs(stddev-10) > 1 {
+		t.Errorf("mean %.2f, stddev %.2f; want about 100 and 10", mean, stddev)
+	}
+
+	// Samples below zero are clamped to Min instead of wrapping around
+	for _, v := range sample(t, ValueSpec{Distribution: "normal", Mean: -50, StdDev: 5, Min: 3, Max: 10}, 1000) {
+		if v != 3 {
+			t.Fatalf("value %d for a negative mean, want the minimum 3", v)
+		}
+	}
+	for _, v := range sample(t, ValueSpec{Distribution: "normal", Mean: 1000, StdDev: 1, Max: 10}, 100) {
+		if v != 10 {
+			t.Fatalf("value %d above the maximum 10", v)
+		}
+	}
+}
+
+func TestInvalidValueSpecs(t *testing.T) {
+	for _, spec := range []ValueSpec{
+		{Distribution: "uniform", Min: 5, Max: 4},
+		{Distribution: "normal", StdDev: -1},
+		{Distribution: "normal", Min: 5, Max: 4},
+		{Distribution: "pareto"},
+	} {
+		if _, err := valueSampler(rand.New(rand.NewSource(1)), spec); err == nil {
+			t.Errorf("%+v accepted", spec)
+		}
+	}
+}
+
+func TestTransferIsDeterministic(t *testing.T) {
+	spec := Spec{
+		Receivers:    []string{"0xa", "0xb", "0xc", "0xd"},
+		Distribution: "zipf",
+		Value:        ValueSpec{Distribution: "uniform", Min: 1, Max: 1000},
+		Seed:         42,
+	}
+	first, err := NewTransfer(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewTransfer(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for i := 1; i <= 1000; i++ {
+		a, _ := first.Next()
+		b, _ := second.Next()
+		if a != b {
+			t.Fatalf("request %d differs with the same seed: %+v and %+v", i, a, b)
+		}
+		if a.ID != i {
+			t.Fatalf("request %d has ID %d", i, a.ID)
+		}
+		counts[a.Receiver]++
+	}
+	// Zipf sends most transfers to the first receiver
+	if counts["0xa"] <= counts["0xb"] || counts["0xb"] < counts["0xd"] {
+		t.Errorf("receiver counts %v, want them to fall off from 0xa", counts)
+	}
+
+	if _, err := NewTransfer(Spec{}); err == nil {
+		t.Error("a transfer workload without receivers was accepted")
+	}
+	if _, err := NewTransfer(Spec{Receivers: spec.Receivers, Distribution: "zipf", ZipfS: 1}); err == nil {
+		t.Error("zipf_s of 1 was accepted")
+	}
+}
@@ -0,0 +1,110 @@
+// Package workload generates the transfers a run submits. Workloads are
+// registered by name, so a run can pick one from config, and teams can add
+// their own from Go code:
+//
+//	func init() {
+//		err := workload.Register("payroll", func(spec workload.Spec) (workload.Workload, error) {
+//			return newPayroll(spec.Receivers, spec.Params)
+//		})
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+//
+// A blank import of the package that registers it makes it available to
+// the run command.
+package workload
+
+import (
+	"fmt"
+	"metrics/parallel"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Workload yields the requests of a run, one per transaction. It is a
+// parallel.RequestSource: executors call Next once per transaction, never
+// concurrently, and stop when ok is false.
+type Workload interface {
+	Next() (req parallel.TransactionRequest, ok bool)
+}
+
+// Spec configures a workload. Built-in workloads read the typed fields;
+// others may read Params as well.
+type Spec struct {
+	// Receivers are the accounts transfers go to.
+	Receivers []string
+	// Distribution picks among Receivers: uniform (default) or zipf.
+	Distribution string
+	// ZipfS is the Zipf exponent, above 1; larger values concentrate
+	// transfers on the first receivers. Zero uses 1.1.
+	ZipfS float64
+	Value ValueSpec
+	// Seed makes the sequence of requests deterministic.
+	Seed   int64
+	Params map[string]interface{}
+}
+
+// ValueSpec describes the values of transfers. Distribution is fixed
+// (default, always Value), uniform (Min to Max inclusive) or normal (Mean
+// and StdDev, rounded and kept between Min and, if set, Max).
+type ValueSpec struct {
+	Distribution string
+	Value        uint64
+	Min          uint64
+	Max          uint64
+	Mean         float64
+	StdDev       float64
+}
+
+// Factory builds a workload from spec.
+type Factory func(spec Spec) (Workload, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a workload available under name. Names are
+// case-insensitive, and registering a name twice is an error.
+func Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("workload: Register needs a name and a factory")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := registry[key]; ok {
+		return fmt.Errorf("workload: %q is already registered", name)
+	}
+	registry[key] = factory
+	return nil
+}
+
+// New builds the workload registered under name, or the built-in transfer
+// workload if name is empty.
+func New(name string, spec Spec) (Workload, error) {
+	if name == "" {
+		name = "transfer"
+	}
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("workload: unknown name %q (registered: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(spec)
+}
+
+// Names lists the registered workloads in alphabetical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,65 @@
+package workload
+
+import (
+	"metrics/parallel"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fixed is a workload that always sends to the same receiver.
+type fixed struct{ receiver string }
+
+func (f fixed) Next() (parallel.TransactionRequest, bool) {
+	return parallel.TransactionRequest{ID: 1, Receiver: f.receiver, Value: 1}, true
+}
+
+func TestRegister(t *testing.T) {
+	err := Register("Test-Fixed", func(spec Spec) (Workload, error) {
+		return fixed{receiver: spec.Receivers[0]}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(Names(), "test-fixed") || !slices.Contains(Names(), "transfer") {
+		t.Errorf("Names = %v, want test-fixed and transfer", Names())
+	}
+
+	// Names are case-insensitive
+	load, err := New("TEST-fixed", Spec{Receivers: []string{"0xa"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, ok := load.Next(); !ok || req.Receiver != "0xa" {
+		t.Errorf("Next = %+v, %v; want a transfer to 0xa", req, ok)
+	}
+
+	if _, err := New("missing", Spec{}); err == nil || !strings.Contains(err.Error(), "test-fixed") {
+		t.Errorf("unknown name: err = %v, want the registered names listed", err)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	factory := func(Spec) (Workload, error) { return fixed{}, nil }
+	if err := Register("test-duplicate", factory); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test-duplicate", "TEST-DUPLICATE", "transfer"} {
+		if err := Register(name, factory); err == nil {
+			t.Errorf("registering %q again succeeded", name)
+		}
+	}
+	if err := Register("", factory); err == nil {
+		t.Error("registering an empty name succeeded")
+	}
+}
+
+func TestNewDefaultsToTransfer(t *testing.T) {
+	load, err := New("", Spec{Receivers: []string{"0xa"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := load.(*Transfer); !ok {
+		t.Errorf("New(\"\") = %T, want *Transfer", load)
+	}
+}